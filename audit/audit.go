@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/mwalto7/netcfg/cfgtree"
+	"gopkg.in/yaml.v2"
+)
+
+// Rule is a compliance rule that a configuration must follow. A rule checks
+// exactly one of Contains, Match, NotMatch or Block.
+type Rule struct {
+	Name   string `yaml:"name"`   // name of the rule in reports
+	Vendor string `yaml:"vendor"` // vendor of the devices the rule applies to, or all if empty
+	OS     string `yaml:"os"`     // OS of the devices the rule applies to, or all if empty
+
+	Contains string `yaml:"contains"`  // line the configuration must contain at the top level
+	Match    string `yaml:"match"`     // regular expression a line of the configuration must match
+	NotMatch string `yaml:"not_match"` // regular expression no line of the configuration may match
+
+	Block   string `yaml:"block"`   // regular expression matching the first line of the blocks to check
+	With    string `yaml:"with"`    // only check the blocks containing this line
+	Require string `yaml:"require"` // line each block checked must contain
+
+	match    *regexp.Regexp
+	notMatch *regexp.Regexp
+	block    *regexp.Regexp
+}
+
+// rules is the format of a rule file.
+type rules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Load reads the rules of a rule file.
+func Load(file string) ([]Rule, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses the rules of a rule file.
+func Parse(b []byte) ([]Rule, error) {
+	var r rules
+	if err := yaml.UnmarshalStrict(b, &r); err != nil {
+		return nil, err
+	}
+	for i := range r.Rules {
+		if err := r.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	return r.Rules, nil
+}
+
+// compile validates a rule, compiles its regular expressions and names it
+// after what it checks if it has no name.
+func (r *Rule) compile() error {
+	n := 0
+	for _, s := range []string{r.Contains, r.Match, r.NotMatch, r.Block} {
+		if s != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("must have exactly one of contains, match, not_match or block")
+	}
+	if r.Block == "" && (r.With != "" || r.Require != "") {
+		return errors.New("with and require need a block")
+	}
+	if r.Block != "" && r.Require == "" {
+		return errors.New("block needs require")
+	}
+
+	var err error
+	re := func(expr string) *regexp.Regexp {
+		if expr == "" || err != nil {
+			return nil
+		}
+		var p *regexp.Regexp
+		if p, err = regexp.Compile(expr); err != nil {
+			err = fmt.Errorf("invalid regular expression: %v", err)
+		}
+		return p
+	}
+	r.match, r.notMatch, r.block = re(r.Match), re(r.NotMatch), re(r.Block)
+	if err != nil {
+		return err
+	}
+	r.Contains, r.With, r.Require = normalize(r.Contains), normalize(r.With), normalize(r.Require)
+
+	if r.Name == "" {
+		switch {
+		case r.Contains != "":
+			r.Name = "contains " + r.Contains
+		case r.Match != "":
+			r.Name = "matches " + r.Match
+		case r.NotMatch != "":
+			r.Name = "does not match " + r.NotMatch
+		default:
+			r.Name = r.Block + " requires " + r.Require
+		}
+	}
+	return nil
+}
+
+// normalize collapses the whitespace of a line of configuration as
+// cfgtree.Parse does.
+func normalize(line string) string {
+	return strings.Join(strings.Fields(line), " ")
+}
+
+// Applies reports whether a rule applies to devices of a vendor and OS.
+// Rules for a vendor or OS do not apply to devices whose vendor or OS is
+// unknown.
+func (r Rule) Applies(vendor, os string) bool {
+	return (r.Vendor == "" || strings.EqualFold(r.Vendor, vendor)) &&
+		(r.OS == "" || strings.EqualFold(r.OS, os))
+}
+
+// Check checks a configuration against a rule and returns an error
+// describing why the configuration breaks the rule, if it does.
+func (r Rule) Check(cfg *cfgtree.Node) error {
+	switch {
+	case r.Contains != "":
+		if cfg.Find(r.Contains) == nil {
+			return fmt.Errorf("missing %q", r.Contains)
+		}
+	case r.match != nil:
+		if find(cfg, r.match.MatchString) == nil {
+			return fmt.Errorf("no line matches %q", r.Match)
+		}
+	case r.notMatch != nil:
+		if n := find(cfg, r.notMatch.MatchString); n != nil {
+			return fmt.Errorf("%q matches %q", n.Line, r.NotMatch)
+		}
+	case r.block != nil:
+		var missing []string
+		walk(cfg, func(n *cfgtree.Node) {
+			if !r.block.MatchString(n.Line) || r.With != "" && n.Find(r.With) == nil {
+				return
+			}
+			if n.Find(r.Require) == nil {
+				missing = append(missing, n.Line)
+			}
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("%q missing from %s", r.Require, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+// find returns the first line under a node, at any depth, that matches, or
+// nil if none do.
+func find(root *cfgtree.Node, match func(string) bool) *cfgtree.Node {
+	var found *cfgtree.Node
+	walk(root, func(n *cfgtree.Node) {
+		if found == nil && match(n.Line) {
+			found = n
+		}
+	})
+	return found
+}
+
+// walk calls fn for every line under a node, at any depth, in order.
+func walk(root *cfgtree.Node, fn func(*cfgtree.Node)) {
+	for _, n := range root.Children {
+		fn(n)
+		walk(n, fn)
+	}
+}
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mwalto7/netcfg/cfgtree"
+)
+
+const (
+	noError  = false
+	hasError = true
+)
+
+const ruleFile = `
+rules:
+  - name: password-encryption
+    vendor: cisco
+    contains: service password-encryption
+  - name: no-public-community
+    not_match: ^snmp-server community public
+  - name: ntp
+    match: ^ntp server
+  - name: access-portfast
+    vendor: cisco
+    os: ios
+    block: ^interface
+    with: switchport mode access
+    require: spanning-tree portfast
+`
+
+const running = `service password-encryption
+!
+interface GigabitEthernet1/0/1
+ switchport mode access
+ spanning-tree portfast
+!
+interface GigabitEthernet1/0/2
+ switchport mode access
+!
+interface GigabitEthernet1/0/48
+ switchport mode trunk
+!
+snmp-server community public RO
+end`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rules   string
+		wantErr bool
+	}{
+		{ruleFile, noError},
+		{"rules:\n  - contains: foo\n    match: bar", hasError},
+		{"rules:\n  - name: empty", hasError},
+		{"rules:\n  - block: ^interface", hasError},
+		{"rules:\n  - contains: foo\n    require: bar", hasError},
+		{"rules:\n  - match: '[a-'", hasError},
+		{"rules:\n  - contians: foo", hasError},
+	}
+	for _, test := range tests {
+		_, err := Parse([]byte(test.rules))
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%q: want error %v, got %v", test.rules, test.wantErr, err)
+		}
+	}
+
+	rules, err := Parse([]byte("rules:\n  - contains: ' logging  buffered'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules[0].Name != "contains logging buffered" {
+		t.Errorf("want default name, got %q", rules[0].Name)
+	}
+}
+
+func TestRule_Applies(t *testing.T) {
+	rules, err := Parse([]byte(ruleFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		vendor, os string
+		want       []bool
+	}{
+		{"CISCO", "IOS", []bool{true, true, true, true}},
+		{"CISCO", "IOS XR", []bool{true, true, true, false}},
+		{"HP", "Comware", []bool{false, true, true, false}},
+		{"", "", []bool{false, true, true, false}},
+	}
+	for _, test := range tests {
+		for i, rule := range rules {
+			if got := rule.Applies(test.vendor, test.os); got != test.want[i] {
+				t.Errorf("%s for %s %s: want %v, got %v", rule.Name, test.vendor, test.os, test.want[i], got)
+			}
+		}
+	}
+}
+
+func TestRule_Check(t *testing.T) {
+	rules, err := Parse([]byte(ruleFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := cfgtree.Parse([]byte(running))
+	want := []string{
+		"",
+		`"snmp-server community public RO" matches "^snmp-server community public"`,
+		`no line matches "^ntp server"`,
+		`"spanning-tree portfast" missing from interface GigabitEthernet1/0/2`,
+	}
+	for i, rule := range rules {
+		var got string
+		if err := rule.Check(cfg); err != nil {
+			got = err.Error()
+		}
+		if got != want[i] {
+			t.Errorf("%s: want %q, got %q", rule.Name, want[i], got)
+		}
+	}
+
+	fixed := strings.Replace(running, "snmp-server community public RO", "ntp server 10.0.0.1", 1)
+	fixed = strings.Replace(fixed, "/0/2\n switchport mode access", "/0/2\n switchport mode access\n spanning-tree portfast", 1)
+	cfg = cfgtree.Parse([]byte(fixed))
+	for _, rule := range rules {
+		if err := rule.Check(cfg); err != nil {
+			t.Errorf("%s: want pass, got %v", rule.Name, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package cfgtree
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// Node is a line of a configuration and the lines indented under it.
+type Node struct {
+	Line     string  // line of configuration, without indentation
+	Children []*Node // lines indented under the line, in order
+	indent   int
+}
+
+// Parse parses a configuration into a tree of its lines by indentation. The
+// root of the tree has no line. Comment lines starting with "!" or "#" are
+// left out, and unindented ones end the block before them, as they separate
+// blocks in Cisco and HP configurations.
+func Parse(cfg []byte) *Node {
+	root := &Node{indent: -1}
+	stack := []*Node{root}
+	sc := bufio.NewScanner(bytes.NewReader(cfg))
+	for sc.Scan() {
+		text := strings.TrimRight(sc.Text(), " \t\r")
+		line := strings.TrimLeft(text, " \t")
+		if line == "" {
+			continue
+		}
+		indent := len(text) - len(line)
+		if line[0] == '!' || line[0] == '#' {
+			if indent == 0 {
+				stack = stack[:1]
+			}
+			continue
+		}
+		for len(stack) > 1 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		n := &Node{Line: strings.Join(strings.Fields(line), " "), indent: indent}
+		parent := stack[len(stack)-1]
+		parent.Children = append(parent.Children, n)
+		stack = append(stack, n)
+	}
+	return root
+}
+
+// Find returns the first child of a node with a line, or nil if there is none.
+func (n *Node) Find(line string) *Node {
+	for _, c := range n.Children {
+		if c.Line == line {
+			return c
+		}
+	}
+	return nil
+}
+
+// Change is a line of a diff between two configurations.
+type Change struct {
+	Op    byte   // '+' for a missing line, '-' for an extra line or ' ' for context
+	Depth int    // depth of the line in the configuration
+	Line  string // line of configuration, without indentation
+}
+
+// String returns the line of a change in unified diff format, indented by
+// its depth.
+func (c Change) String() string {
+	return string(c.Op) + strings.Repeat(" ", c.Depth) + c.Line
+}
+
+// Diff returns the changes needed to bring a running configuration in line
+// with an intended one. The intended configuration only needs to contain
+// the lines it cares about: lines of the running configuration outside the
+// blocks it contains are left alone, but every line of a block it contains
+// must be intended. An intended "no" line, such as "no ip http server",
+// requires the line it negates to be missing. Blocks that differ are shown
+// with their first line as context.
+func Diff(running, intended *Node) []Change {
+	return diff(running, intended, 0)
+}
+
+func diff(running, intended *Node, depth int) []Change {
+	var changes []Change
+	for _, want := range intended.Children {
+		if neg := strings.TrimPrefix(want.Line, "no "); neg != want.Line && running.Find(want.Line) == nil {
+			if have := running.Find(neg); have != nil {
+				changes = append(changes, tree(have, '-', depth)...)
+			}
+			continue
+		}
+		have := running.Find(want.Line)
+		if have == nil {
+			changes = append(changes, tree(want, '+', depth)...)
+			continue
+		}
+		if len(want.Children) == 0 {
+			continue
+		}
+		if sub := diff(have, want, depth+1); len(sub) > 0 {
+			changes = append(changes, Change{' ', depth, want.Line})
+			changes = append(changes, sub...)
+		}
+	}
+	if depth == 0 {
+		return changes
+	}
+	for _, have := range running.Children {
+		if intended.Find(have.Line) == nil && intended.Find("no "+have.Line) == nil {
+			changes = append(changes, tree(have, '-', depth)...)
+		}
+	}
+	return changes
+}
+
+// tree returns a change for a node and every node under it.
+func tree(n *Node, op byte, depth int) []Change {
+	changes := []Change{{op, depth, n.Line}}
+	for _, c := range n.Children {
+		changes = append(changes, tree(c, op, depth+1)...)
+	}
+	return changes
+}
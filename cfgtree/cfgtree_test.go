@@ -0,0 +1,96 @@
+package cfgtree
+
+import (
+	"strings"
+	"testing"
+)
+
+const running = `Building configuration...
+!
+hostname Switch
+!
+interface GigabitEthernet1/0/1
+ description uplink
+ switchport mode trunk
+ spanning-tree portfast
+!
+interface GigabitEthernet1/0/2
+ switchport access vlan 10
+ shutdown
+!
+router bgp 65000
+ neighbor 10.0.0.2 remote-as 65001
+ address-family ipv4
+  network 10.1.0.0 mask 255.255.0.0
+ exit-address-family
+!
+ip http server
+end`
+
+func TestParse(t *testing.T) {
+	root := Parse([]byte(running))
+	var lines []string
+	for _, c := range root.Children {
+		lines = append(lines, c.Line)
+	}
+	want := []string{
+		"Building configuration...",
+		"hostname Switch",
+		"interface GigabitEthernet1/0/1",
+		"interface GigabitEthernet1/0/2",
+		"router bgp 65000",
+		"ip http server",
+		"end",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want top-level lines %q, got %q", want, lines)
+	}
+
+	af := root.Find("router bgp 65000").Find("address-family ipv4")
+	if af == nil || len(af.Children) != 1 || af.Children[0].Line != "network 10.1.0.0 mask 255.255.0.0" {
+		t.Errorf("want address family with one network, got %+v", af)
+	}
+
+	// HP Comware configurations indent global commands between "#" lines
+	root = Parse([]byte("#\n sysname HP\n#\ninterface GigabitEthernet1/0/1\n port link-type trunk\n#\nreturn"))
+	if n := root.Find("sysname HP"); n == nil || len(root.Children) != 3 {
+		t.Errorf("want sysname at the top level, got %+v", root.Children)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		intended string
+		want     string
+	}{
+		{"hostname Switch\ninterface GigabitEthernet1/0/1\n description uplink\n switchport mode trunk\n spanning-tree portfast", ""},
+		{"hostname Switch2", "+hostname Switch2"},
+		{"no ip http server", "-ip http server"},
+		{"no ip domain lookup", ""},
+		{
+			"interface GigabitEthernet1/0/1\n description core uplink\n switchport mode trunk\n spanning-tree portfast",
+			" interface GigabitEthernet1/0/1\n+ description core uplink\n- description uplink",
+		},
+		{
+			"interface GigabitEthernet1/0/2\n switchport access vlan 10\n no shutdown",
+			" interface GigabitEthernet1/0/2\n- shutdown",
+		},
+		{
+			"router bgp 65000\n neighbor 10.0.0.2 remote-as 65001\n address-family ipv4\n  network 10.2.0.0 mask 255.255.0.0\n exit-address-family",
+			" router bgp 65000\n  address-family ipv4\n+  network 10.2.0.0 mask 255.255.0.0\n-  network 10.1.0.0 mask 255.255.0.0",
+		},
+		{
+			"interface Vlan10\n ip address 10.0.10.1 255.255.255.0",
+			"+interface Vlan10\n+ ip address 10.0.10.1 255.255.255.0",
+		},
+	}
+	for _, test := range tests {
+		var lines []string
+		for _, c := range Diff(Parse([]byte(running)), Parse([]byte(test.intended))) {
+			lines = append(lines, c.String())
+		}
+		if got := strings.Join(lines, "\n"); got != test.want {
+			t.Errorf("%q: want diff\n%s\ngot\n%s", test.intended, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/mwalto7/netcfg/audit"
+	"github.com/mwalto7/netcfg/cfgtree"
+	"github.com/mwalto7/netcfg/device"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditRules string
+	auditDir   string
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit [config file]",
+	Short: "Check the configurations of hosts against compliance rules",
+	Long: `Check the running configuration of the hosts in a configuration file
+against the rules in a rule file, and print whether each host passes
+each rule. Rules for a vendor or OS only apply to the hosts of that
+vendor or OS.
+
+The configurations are read from the hosts, or from the files saved
+by 'netcfg backup' to the directory given with the '--dir' flag.
+Exits with an error if any host fails a rule.
+
+  netcfg audit config.yml --rules rules.yml
+  netcfg audit config.yml --rules rules.yml --dir backups`,
+	Args: cobra.ExactArgs(1),
+	RunE: auditCmdRunE,
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.Flags().StringVarP(&auditRules, "rules", "r", "", "rule file to check the configurations against (required)")
+	auditCmd.Flags().StringVarP(&auditDir, "dir", "d", "", "directory of backups to read the configurations from instead of the hosts")
+	auditCmd.Flags().StringVarP(&limit, "limit", "l", "", "only audit hosts matching these groups or glob patterns")
+	auditCmd.Flags().StringVarP(&tmpl, "template", "t", "", "template data to use in configuration file")
+	auditCmd.Flags().IntVarP(&workers, "workers", "w", 1, "number of workers to run, more = faster")
+}
+
+// auditCmdRunE is the function run for the `auditCmd`.
+func auditCmdRunE(_ *cobra.Command, args []string) error {
+	if auditRules == "" {
+		return errors.New("audit: no rule file, use --rules")
+	}
+	rules, err := audit.Load(auditRules)
+	if err != nil {
+		return fmt.Errorf("audit: could not read %s: %v", auditRules, err)
+	}
+	cfg, err := parseConfig(args[0])
+	if err != nil {
+		return err
+	}
+	if err := setDeviceOptions(cfg); err != nil {
+		return fmt.Errorf("audit: %v", err)
+	}
+
+	hosts, err := loadHosts(cfg)
+	if err != nil {
+		return fmt.Errorf("audit: %v", err)
+	}
+	if len(hosts) == 0 {
+		return errors.New("audit: no hosts to audit")
+	}
+
+	var jobs []job
+	var jumps []device.Jump
+	if auditDir == "" {
+		if jobs, jumps, err = newJobs(cfg, hosts); err != nil {
+			return fmt.Errorf("audit: %v", err)
+		}
+	} else {
+		for _, host := range hosts {
+			jobs = append(jobs, job{host: host})
+		}
+	}
+
+	var mu sync.Mutex
+	checks := make(map[string][]error, len(jobs))
+	results := runJobs(jobs, func(j job) result {
+		vendor, osName, running, err := auditConfig(j, jumps)
+		if err != nil {
+			return result{j.host.String(), nil, err}
+		}
+		c := checkRules(rules, vendor, osName, cfgtree.Parse(running))
+		mu.Lock()
+		checks[j.host.String()] = c
+		mu.Unlock()
+		return result{j.host.String(), nil, nil}
+	})
+	failed := 0
+	for res := range results {
+		if res.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s error: %v\n", res.host, res.err)
+		}
+	}
+
+	var names []string
+	for _, host := range hosts {
+		if _, ok := checks[host.String()]; ok {
+			names = append(names, host.String())
+		}
+	}
+	nonCompliant := printMatrix(os.Stdout, rules, names, checks)
+
+	if nonCompliant > 0 {
+		return fmt.Errorf("audit: %d of %d hosts failed rules", nonCompliant, len(hosts))
+	}
+	if failed > 0 {
+		return fmt.Errorf("audit: %d of %d hosts failed", failed, len(hosts))
+	}
+	return nil
+}
+
+// errNotApplicable is the result of a rule that does not apply to a host.
+var errNotApplicable = errors.New("does not apply")
+
+// auditConfig returns the vendor, OS and running configuration of the host
+// of a job, read from its backup file with the `--dir` flag or else from the
+// host.
+func auditConfig(j job, jumps []device.Jump) (vendor, osName string, running []byte, err error) {
+	if auditDir != "" {
+		return readBackup(filepath.Join(auditDir, backupName(j.host)))
+	}
+	client, err := dialHost(j, jumps)
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer client.Close()
+	running, err = client.RunningConfig()
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to get running config: %v", err)
+	}
+	return client.Vendor(), client.OS(), stripVolatile(running), nil
+}
+
+// checkRules checks a configuration against each rule that applies to its
+// vendor and OS, returning the result of each rule in order.
+func checkRules(rules []audit.Rule, vendor, osName string, cfg *cfgtree.Node) []error {
+	checks := make([]error, len(rules))
+	for i, rule := range rules {
+		if !rule.Applies(vendor, osName) {
+			checks[i] = errNotApplicable
+			continue
+		}
+		checks[i] = rule.Check(cfg)
+	}
+	return checks
+}
+
+// printMatrix writes whether each host passes each rule, followed by why each
+// failed rule failed, and returns the number of hosts that failed any rule.
+func printMatrix(w io.Writer, rules []audit.Rule, hosts []string, checks map[string][]error) int {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "HOST")
+	for _, rule := range rules {
+		fmt.Fprintf(tw, "\t%s", rule.Name)
+	}
+	fmt.Fprintln(tw)
+
+	var failures []string
+	failed := 0
+	for _, host := range hosts {
+		fmt.Fprint(tw, host)
+		hostFailed := false
+		for i, err := range checks[host] {
+			switch {
+			case err == nil:
+				fmt.Fprint(tw, "\tpass")
+			case err == errNotApplicable:
+				fmt.Fprint(tw, "\t-")
+			default:
+				fmt.Fprint(tw, "\tFAIL")
+				failures = append(failures, fmt.Sprintf("%s: %s: %v", host, rules[i].Name, err))
+				hostFailed = true
+			}
+		}
+		fmt.Fprintln(tw)
+		if hostFailed {
+			failed++
+		}
+	}
+	tw.Flush()
+
+	if len(failures) > 0 {
+		fmt.Fprintln(w)
+		for _, f := range failures {
+			fmt.Fprintln(w, f)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mwalto7/netcfg/audit"
+)
+
+func TestReadBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netcfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		file       string
+		vendor, os string
+		running    string
+	}{
+		{
+			"#### vendor: CISCO, os: IOS XR ####\n#### running-config ####\nhostname core-1\nend\n\n#### startup-config ####\nhostname old\n",
+			"CISCO", "IOS XR", "hostname core-1\nend\n\n",
+		},
+		{"#### running-config ####\nhostname switch-1\n", "", "", "hostname switch-1\n"},
+		{"hostname switch-1\nend\n", "", "", "hostname switch-1\nend\n"},
+	}
+	for _, test := range tests {
+		file := filepath.Join(dir, "host.cfg")
+		if err := ioutil.WriteFile(file, []byte(test.file), 0600); err != nil {
+			t.Fatal(err)
+		}
+		vendor, osName, running, err := readBackup(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vendor != test.vendor || osName != test.os || string(running) != test.running {
+			t.Errorf("want %q, %q and %q, got %q, %q and %q", test.vendor, test.os, test.running, vendor, osName, running)
+		}
+	}
+
+	if _, _, _, err := readBackup(filepath.Join(dir, "missing.cfg")); err == nil {
+		t.Error("want error for missing file, got nil")
+	}
+}
+
+func TestPrintMatrix(t *testing.T) {
+	rules, err := audit.Parse([]byte("rules:\n  - name: encryption\n    contains: service password-encryption\n  - name: portfast\n    vendor: cisco\n    block: ^interface\n    require: spanning-tree portfast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := map[string][]error{
+		"switch-1": {nil, nil},
+		"switch-2": {errors.New(`missing "service password-encryption"`), errNotApplicable},
+	}
+	want := strings.Join([]string{
+		"HOST      encryption  portfast",
+		"switch-1  pass        pass",
+		"switch-2  FAIL        -",
+		"",
+		`switch-2: encryption: missing "service password-encryption"`,
+		"",
+	}, "\n")
+
+	var buf bytes.Buffer
+	if n := printMatrix(&buf, rules, []string{"switch-1", "switch-2"}, checks); n != 1 {
+		t.Errorf("want 1 failed host, got %d", n)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mwalto7/netcfg/device"
+	"github.com/spf13/cobra"
+)
+
+var (
+	backupDir string
+	backupGit bool
+)
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup [config file]",
+	Short: "Save the configurations of hosts",
+	Long: `Save the running and startup configurations of the hosts in a
+configuration file, one file per host, to a directory.
+
+Lines that change without the configuration changing, such as
+timestamps and NTP clock periods, are removed so that files only
+change when the configuration of a host changes. Pass the '--git'
+flag to commit the changes to a git repository in the directory.
+
+  netcfg backup config.yml --dir backups --git`,
+	Args: cobra.ExactArgs(1),
+	RunE: backupCmdRunE,
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.Flags().StringVarP(&backupDir, "dir", "d", "", "directory to save the configurations to (default is 'backup' in the config or 'backups')")
+	backupCmd.Flags().BoolVar(&backupGit, "git", false, "commit the changes to a git repository in the directory")
+	backupCmd.Flags().StringVarP(&limit, "limit", "l", "", "only back up hosts matching these groups or glob patterns")
+	backupCmd.Flags().StringVarP(&tmpl, "template", "t", "", "template data to use in configuration file")
+	backupCmd.Flags().IntVarP(&workers, "workers", "w", 1, "number of workers to run, more = faster")
+}
+
+// backupCmdRunE is the function run for the `backupCmd`.
+func backupCmdRunE(_ *cobra.Command, args []string) error {
+	cfg, err := parseConfig(args[0])
+	if err != nil {
+		return err
+	}
+	if err := setDeviceOptions(cfg); err != nil {
+		return fmt.Errorf("backup: %v", err)
+	}
+
+	dir := backupDir
+	if dir == "" {
+		dir = cfg.Backup
+	}
+	if dir == "" {
+		dir = "backups"
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("backup: could not create directory: %v", err)
+	}
+
+	hosts, err := loadHosts(cfg)
+	if err != nil {
+		return fmt.Errorf("backup: %v", err)
+	}
+	if len(hosts) == 0 {
+		return errors.New("backup: no hosts to back up")
+	}
+	jobs, jumps, err := newJobs(cfg, hosts)
+	if err != nil {
+		return fmt.Errorf("backup: %v", err)
+	}
+	files := make(map[string]string, len(jobs))
+	for _, j := range jobs {
+		files[j.host.String()] = filepath.Join(dir, backupName(j.host))
+	}
+
+	results := runJobs(jobs, func(j job) result {
+		return result{j.host.String(), nil, backup(j, jumps, files[j.host.String()])}
+	})
+	failed := 0
+	for res := range results {
+		if res.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s error: %v\n", res.host, res.err)
+			continue
+		}
+		fmt.Printf("%s: saved %s\n", res.host, files[res.host])
+	}
+
+	if backupGit {
+		msg := fmt.Sprintf("netcfg backup %s", time.Now().Format("2006-01-02 15:04:05"))
+		if err := gitCommit(dir, msg); err != nil {
+			return fmt.Errorf("backup: %v", err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("backup: %d of %d hosts failed", failed, len(hosts))
+	}
+	return nil
+}
+
+// backup saves the running and startup configurations of the host of a job
+// to a file.
+func backup(j job, jumps []device.Jump, file string) error {
+	client, err := dialHost(j, jumps)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	running, err := client.RunningConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get running config: %v", err)
+	}
+	startup, err := client.StartupConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get startup config: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if client.Vendor() != "" {
+		fmt.Fprintf(&buf, "#### vendor: %s, os: %s ####\n", client.Vendor(), client.OS())
+	}
+	fmt.Fprintf(&buf, "#### running-config ####\n%s\n", stripVolatile(running))
+	if len(startup) > 0 {
+		fmt.Fprintf(&buf, "\n#### startup-config ####\n%s\n", stripVolatile(startup))
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0600)
+}
+
+// backupHeader matches the line of a backup file that names the vendor and
+// OS of the host.
+var backupHeader = regexp.MustCompile(`^#### vendor: (.*), os: (.*) ####$`)
+
+// readBackup reads the vendor, OS and running configuration of a host from a
+// backup file. A file without sections, such as those saved by 'netcfg run',
+// is all running configuration.
+func readBackup(file string) (vendor, osName string, running []byte, err error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if !bytes.HasPrefix(b, []byte("####")) {
+		return "", "", b, nil
+	}
+
+	var buf bytes.Buffer
+	inRunning := false
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := sc.Text()
+		if m := backupHeader.FindStringSubmatch(line); m != nil {
+			vendor, osName = m[1], m[2]
+			continue
+		}
+		if strings.HasPrefix(line, "#### ") && strings.HasSuffix(line, "-config ####") {
+			inRunning = line == "#### running-config ####"
+			continue
+		}
+		if inRunning {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return vendor, osName, buf.Bytes(), sc.Err()
+}
+
+// volatile matches lines of a configuration that change without the
+// configuration changing, such as timestamps and NTP clock periods.
+var volatile = regexp.MustCompile(`^(?:!+ ?(?:Last configuration change|NVRAM config last updated|No configuration change since)|!Time:|Building configuration|Current configuration ?:|Using \d+ out of \d+ bytes|ntp clock-period |(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun) \w{3} +\d+ \d+:\d+:\d+)`)
+
+// stripVolatile removes the volatile lines and leading blank lines of a
+// configuration.
+func stripVolatile(cfg []byte) []byte {
+	var buf bytes.Buffer
+	sc := bufio.NewScanner(bytes.NewReader(cfg))
+	for sc.Scan() {
+		line := sc.Text()
+		if volatile.MatchString(line) || buf.Len() == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// gitCommit commits all changes in a directory to a git repository in the
+// directory, creating the repository if needed.
+func gitCommit(dir, msg string) error {
+	git := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, bytes.TrimSpace(out))
+		}
+		return out, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := git("init", "-q"); err != nil {
+			return err
+		}
+	}
+	if _, err := git("add", "-A"); err != nil {
+		return err
+	}
+	status, err := git("status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(status)) == 0 {
+		return nil
+	}
+
+	// commit as netcfg if no git identity is configured
+	args := []string{"commit", "-q", "-m", msg}
+	if name, _ := git("config", "user.email"); len(bytes.TrimSpace(name)) == 0 {
+		args = append([]string{"-c", "user.name=netcfg", "-c", "user.email=netcfg@localhost"}, args...)
+	}
+	_, err = git(args...)
+	return err
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStripVolatile(t *testing.T) {
+	tests := []struct {
+		cfg  string
+		want string
+	}{
+		{
+			cfg: "Building configuration...\n\nCurrent configuration : 1234 bytes\n!\n" +
+				"! Last configuration change at 12:00:00 UTC Mon Jan 1 2018 by admin\n" +
+				"! NVRAM config last updated at 12:00:00 UTC Mon Jan 1 2018 by admin\n" +
+				"!\nversion 15.0\nntp clock-period 36028797\nntp server 10.0.0.1\nend",
+			want: "!\n!\nversion 15.0\nntp server 10.0.0.1\nend",
+		},
+		{
+			cfg:  "Mon Jan  1 12:00:00.000 UTC\nBuilding configuration...\n!! IOS XR Configuration 6.1.3\n!! Last configuration change at Mon Jan  1 11:00:00 2018 by admin\nhostname core-1\nend",
+			want: "!! IOS XR Configuration 6.1.3\nhostname core-1\nend",
+		},
+		{
+			cfg:  "!Command: show running-config\n!Time: Mon Jan  1 12:00:00 2018\n\nversion 7.0(3)I7(4)\nhostname nexus-1",
+			want: "!Command: show running-config\n\nversion 7.0(3)I7(4)\nhostname nexus-1",
+		},
+		{
+			cfg:  "#\n version 7.1.045, Release 2418P06\n#\n sysname HPE",
+			want: "#\n version 7.1.045, Release 2418P06\n#\n sysname HPE",
+		},
+	}
+	for _, test := range tests {
+		if got := string(stripVolatile([]byte(test.cfg))); got != test.want {
+			t.Errorf("want:\n%s\ngot:\n%s", test.want, got)
+		}
+	}
+}
+
+func TestGitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "netcfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	commits := func() int {
+		cmd := exec.Command("git", "rev-list", "--count", "HEAD")
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if err != nil {
+			return 0
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(string(out)))
+		return n
+	}
+
+	file := filepath.Join(dir, "10.0.0.1.cfg")
+	if err := ioutil.WriteFile(file, []byte("hostname switch-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitCommit(dir, "backup 1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := commits(); n != 1 {
+		t.Fatalf("want 1 commit, got %d", n)
+	}
+
+	// no changes, no commit
+	if err := gitCommit(dir, "backup 2"); err != nil {
+		t.Fatal(err)
+	}
+	if n := commits(); n != 1 {
+		t.Errorf("want 1 commit, got %d", n)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mwalto7/netcfg/cfgtree"
+	"github.com/mwalto7/netcfg/config"
+	"github.com/mwalto7/netcfg/device"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [config file]",
+	Short: "Compare the configurations of hosts to a configuration file",
+	Long: `Compare the running configuration of each host to the 'mode: config'
+command set that applies to it in a configuration file, rendered with
+the template data from the '--template' flag as for 'netcfg run'.
+
+Indented blocks, such as interfaces, are compared as a whole: a line
+in a block of the running configuration that is not in the same block
+of the command set is drift. Lines outside the blocks of the command
+set are ignored. Exits with an error if any host has drifted.
+
+  netcfg diff config.yml -t data.yml`,
+	Args: cobra.ExactArgs(1),
+	RunE: diffCmdRunE,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVarP(&limit, "limit", "l", "", "only compare hosts matching these groups or glob patterns")
+	diffCmd.Flags().StringVarP(&tmpl, "template", "t", "", "template data to use in configuration file")
+	diffCmd.Flags().IntVarP(&workers, "workers", "w", 1, "number of workers to run, more = faster")
+}
+
+// diffCmdRunE is the function run for the `diffCmd`.
+func diffCmdRunE(_ *cobra.Command, args []string) error {
+	cfg, err := parseConfig(args[0])
+	if err != nil {
+		return err
+	}
+	if err := setDeviceOptions(cfg); err != nil {
+		return fmt.Errorf("diff: %v", err)
+	}
+
+	hosts, err := loadHosts(cfg)
+	if err != nil {
+		return fmt.Errorf("diff: %v", err)
+	}
+	if len(hosts) == 0 {
+		return errors.New("diff: no hosts to compare")
+	}
+	matcher, err := config.NewMatcher(cfg)
+	if err != nil {
+		return fmt.Errorf("diff: invalid command set: %v", err)
+	}
+	jobs, jumps, err := newJobs(cfg, hosts)
+	if err != nil {
+		return fmt.Errorf("diff: %v", err)
+	}
+
+	var mu sync.Mutex
+	diffs := make(map[string][]cfgtree.Change, len(jobs))
+	results := runJobs(jobs, func(j job) result {
+		host, changes, err := diffHost(matcher, jumps, j)
+		mu.Lock()
+		diffs[host] = changes
+		mu.Unlock()
+		return result{host, nil, err}
+	})
+	failed, drifted := 0, 0
+	for res := range results {
+		if res.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s error: %v\n", res.host, res.err)
+			continue
+		}
+		mu.Lock()
+		changes := diffs[res.host]
+		mu.Unlock()
+		if len(changes) > 0 {
+			drifted++
+		}
+		printDiff(os.Stdout, res.host, changes)
+	}
+
+	var msgs []string
+	if drifted > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d of %d hosts have drifted", drifted, len(hosts)))
+	}
+	if failed > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d of %d hosts failed", failed, len(hosts)))
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("diff: %s", strings.Join(msgs, ", "))
+	}
+	return nil
+}
+
+// diffHost compares the running configuration of the host of a job to the
+// configuration mode command sets that apply to it.
+func diffHost(matcher *config.Matcher, jumps []device.Jump, j job) (string, []cfgtree.Change, error) {
+	client, err := dialHost(j, jumps)
+	if err != nil {
+		return j.host.String(), nil, err
+	}
+	defer client.Close()
+
+	var cmds []config.Cmd
+	for _, set := range matcher.Match(hostFacts(client, j.host)) {
+		if set.Mode == "config" {
+			cmds = append(cmds, set.Cmds...)
+		}
+	}
+	if len(cmds) == 0 {
+		return j.host.String(), nil, errors.New("no configuration mode commands to compare")
+	}
+	running, err := client.RunningConfig()
+	if err != nil {
+		return j.host.String(), nil, fmt.Errorf("failed to get running config: %v", err)
+	}
+	return j.host.String(), cfgtree.Diff(cfgtree.Parse(stripVolatile(running)), intended(cmds)), nil
+}
+
+// intended returns the configuration that a set of configuration mode
+// commands results in.
+func intended(cmds []config.Cmd) *cfgtree.Node {
+	lines := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		lines[i] = cmd.Cmd
+	}
+	return cfgtree.Parse([]byte(strings.Join(lines, "\n")))
+}
+
+// printDiff writes the changes to the running configuration of a host in
+// unified diff format, or that the host has not drifted.
+func printDiff(w io.Writer, host string, changes []cfgtree.Change) {
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "%s: no drift\n", host)
+		return
+	}
+	fmt.Fprintf(w, "--- %s running-config\n+++ %s intended\n", host, host)
+	for _, c := range changes {
+		fmt.Fprintln(w, c)
+	}
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mwalto7/netcfg/cfgtree"
+	"github.com/mwalto7/netcfg/config"
+)
+
+func TestIntended(t *testing.T) {
+	cmds := []config.Cmd{
+		{Cmd: "interface Gi1/0/1"},
+		{Cmd: " description uplink"},
+		{Cmd: "ntp server 10.0.0.1"},
+	}
+	root := intended(cmds)
+	if len(root.Children) != 2 || root.Find("interface Gi1/0/1").Find("description uplink") == nil {
+		t.Errorf("want interface block and ntp server, got %+v", root.Children)
+	}
+}
+
+func TestPrintDiff(t *testing.T) {
+	var buf bytes.Buffer
+	printDiff(&buf, "switch-1", nil)
+	printDiff(&buf, "switch-2", []cfgtree.Change{
+		{Op: ' ', Line: "interface Gi1/0/1"},
+		{Op: '+', Depth: 1, Line: "description uplink"},
+		{Op: '-', Line: "ip http server"},
+	})
+	want := strings.Join([]string{
+		"switch-1: no drift",
+		"--- switch-2 running-config",
+		"+++ switch-2 intended",
+		" interface Gi1/0/1",
+		"+ description uplink",
+		"-ip http server",
+		"",
+	}, "\n")
+	if got := buf.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
@@ -263,11 +263,11 @@ acceptPrompt:
 		}
 		if a != "" {
 			switch a {
-			case "all", "known_hosts":
+			case "all", "known_hosts", "tofu":
 				data["accept"] = a
 				break acceptPrompt
 			default:
-				fmt.Fprintf(os.Stderr, "Expected 'all' or 'known_hosts', got %q\n", a)
+				fmt.Fprintf(os.Stderr, "Expected 'all', 'known_hosts' or 'tofu', got %q\n", a)
 				continue
 			}
 		}
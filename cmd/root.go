@@ -25,6 +25,7 @@ import (
 	"os"
 
 	"github.com/mitchellh/go-homedir"
+	"github.com/mwalto7/netcfg/device"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -71,4 +72,31 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
+	if file := viper.GetString("parsers"); file != "" {
+		if _, err := loadParsers(file); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+}
+
+// loadParsers registers the device parser rules of a YAML file by its path,
+// which are tried before the built-in parsers to identify devices, and
+// returns the registered parser.
+func loadParsers(file string) (device.Parser, error) {
+	path, err := homedir.Expand(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not expand parsers path %s: %v", file, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open parsers file %s: %v", file, err)
+	}
+	defer f.Close()
+	p, err := device.ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse parsers file %s: %v", file, err)
+	}
+	device.RegisterParser(path, p)
+	return p, nil
 }
@@ -1 +1,40 @@
 package cmd
+
+import (
+	"testing"
+
+	"github.com/mwalto7/netcfg/device"
+)
+
+func TestLoadParsers(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		ok   bool
+	}{
+		{"rules", "testdata/parsers.yml", noError},
+		{"not rules", "testdata/tmpl_data.yml", hasError},
+		{"missing", "testdata/missing.yml", hasError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := loadParsers(test.file)
+			switch {
+			case err != nil && test.ok:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !test.ok:
+				t.Fatal("expected error, got none")
+			case err != nil && !test.ok:
+				t.Logf("got expected error: %v", err)
+				return
+			}
+			defer device.UnregisterParser(test.file)
+
+			want := device.Info{Vendor: "JUNIPER", OS: "JUNOS", Model: "mx240", Version: "15.1R7.9"}
+			got, ok := p.Parse(".1.3.6.1.4.1.2636.1.1.1.2.29", "Juniper Networks, Inc. mx240 internet router, kernel JUNOS 15.1R7.9, Build date: 2018-07-19")
+			if !ok || got != want {
+				t.Errorf("want %+v, got %+v (%t)", want, got, ok)
+			}
+		})
+	}
+}
@@ -21,24 +21,29 @@
 package cmd
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/mwalto7/netcfg/config"
 	"github.com/mwalto7/netcfg/device"
+	"github.com/mwalto7/netcfg/inventory"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"golang.org/x/crypto/ssh"
 )
 
 var (
 	dryRun  bool
+	limit   string
 	tmpl    string
 	workers int
 )
@@ -53,50 +58,109 @@ var runCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().BoolVar(&dryRun, "dry-run", false, "test a configuration without configuring any hosts")
+	runCmd.Flags().StringVarP(&limit, "limit", "l", "", "only configure hosts matching these groups or glob patterns")
 	runCmd.Flags().StringVarP(&tmpl, "template", "t", "", "template data to use in configuration file")
 	runCmd.Flags().StringP("community", "c", "public", "SNMP v2c community string")
+	viper.BindPFlag("snmp.community", runCmd.Flags().Lookup("community"))
 	runCmd.Flags().IntVarP(&workers, "workers", "w", 1, "number of workers to run, more = faster")
 }
 
 // runCmdRunE is the function fun for the `runCmd`.
 func runCmdRunE(_ *cobra.Command, args []string) error {
+	cfg, err := parseConfig(args[0])
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return dryRunCfg(cfg)
+	}
+	if err := setDeviceOptions(cfg); err != nil {
+		return fmt.Errorf("run: %v", err)
+	}
+	return runCfg(cfg)
+}
+
+// parseConfig reads and parses a config file with the template data from the
+// `--template` flag.
+func parseConfig(file string) (*config.Config, error) {
 	var cfgData, tmplData string
 
-	b, err := ioutil.ReadFile(args[0])
+	b, err := ioutil.ReadFile(file)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	cfgData = string(b)
 
 	if tmpl != "" {
 		b, err := ioutil.ReadFile(tmpl)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		tmplData = string(b)
 	}
+	return config.New("cfg").Template(tmplData).Parse(cfgData)
+}
 
-	cfg, err := config.New("cfg").Template(tmplData).Parse(cfgData)
+// setDeviceOptions sets the options for running commands on devices from a
+// config.
+func setDeviceOptions(cfg *config.Config) error {
+	device.Timeout = cfg.Timeout
+	device.StopOnError = cfg.StopOnError
+	device.EnableSecret = cfg.EnableSecret
+	for _, expr := range cfg.Errors {
+		p, err := regexp.Compile("(?m)" + expr)
+		if err != nil {
+			return fmt.Errorf("invalid error pattern: %v", err)
+		}
+		device.ErrorPatterns = append(device.ErrorPatterns, p)
+	}
+	return nil
+}
+
+// loadHosts reads the hosts to configure from the hosts file of a config,
+// expanding any CIDR blocks and IP ranges and applying the `--limit` flag.
+func loadHosts(cfg *config.Config) ([]inventory.Host, error) {
+	hosts, err := inventory.Load(cfg.Hosts, cfg.Inventory)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to read %s: %v", cfg.Hosts, err)
 	}
-	if dryRun {
-		return dryRunCfg(cfg)
+	hosts, err = inventory.Expand(hosts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand hosts in %s: %v", cfg.Hosts, err)
 	}
-	device.Timeout = cfg.Timeout
-	return runCfg(cfg)
+	if limit != "" {
+		return inventory.Limit(hosts, limit)
+	}
+	return hosts, nil
 }
 
-// dryRunCfg prints out the parsed config and all command sets.
+// dryRunCfg prints out the parsed config, the hosts to configure and all
+// command sets.
 func dryRunCfg(cfg *config.Config) error {
 	fmt.Println(cfg.Name())
-	cfgCmds, err := config.MapCmds(cfg)
+	hosts, err := loadHosts(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dry run: %v\n", err)
+	} else {
+		fmt.Println("[hosts]")
+		for _, host := range hosts {
+			fmt.Println(host)
+		}
+		fmt.Println()
+	}
+	matcher, err := config.NewMatcher(cfg)
 	if err != nil {
 		return err
 	}
-	for vendor, cmdSet := range cfgCmds {
-		fmt.Printf("[%s]\n", vendor)
-		for _, cmd := range cmdSet {
+	for _, cmdSet := range matcher.Sets {
+		fmt.Printf("[%s]\n", cmdSet.Filter)
+		if cmdSet.Priority != 0 {
+			fmt.Printf("priority: %d\n", cmdSet.Priority)
+		}
+		if cmdSet.Mode != "" {
+			fmt.Printf("mode: %s\n", cmdSet.Mode)
+		}
+		for _, cmd := range cmdSet.Cmds {
 			fmt.Println(cmd)
 		}
 		fmt.Println()
@@ -105,58 +169,233 @@ func dryRunCfg(cfg *config.Config) error {
 	return nil
 }
 
+// job represents a host to configure and its SSH client configuration.
+type job struct {
+	host      inventory.Host    // host to configure
+	clientCfg *ssh.ClientConfig // ssh client config for the host
+	snmp      device.SNMP       // snmp settings to discover the host with
+	backup    string            // file to save the running config to, if any
+	restore   bool              // restore the running config if configuration fails
+}
+
+// commands are the commands to run on the hosts that a command set applies to.
+type commands struct {
+	config bool              // run the commands in configuration mode
+	mode   device.ConfigMode // how a commit is confirmed in configuration mode
+	cmds   []device.Command  // commands to run
+}
+
 // result represents a configuration result.
 type result struct {
-	host string // host configured
-	out  []byte // output of configuration
-	err  error  // error from configuration
+	host string          // host configured
+	cmds []device.Output // output of each command run, in order
+	err  error           // error from configuration
 }
 
 // runCfg is the `runCmd`'s main function.
 func runCfg(cfg *config.Config) error {
-	// read hosts file from user config
-	hostsData, err := ioutil.ReadFile(cfg.Hosts)
+	// read hosts from the hosts file in the user config
+	hosts, err := loadHosts(cfg)
 	if err != nil {
-		return fmt.Errorf("run: failed to read %s: %v", cfg.Hosts, err)
+		return fmt.Errorf("run: %v", err)
+	}
+	if len(hosts) == 0 {
+		return errors.New("run: no hosts to configure")
 	}
 
-	// scan hosts line-by-line from hosts file
-	var hosts []string
-	s := bufio.NewScanner(bytes.NewReader(hostsData))
-	for s.Scan() {
-		line := s.Text()
-		if line != "" {
-			hosts = append(hosts, line)
+	// choose the command sets of each host from the user config
+	matcher, err := config.NewMatcher(cfg)
+	if err != nil {
+		return fmt.Errorf("run: invalid command set: %v", err)
+	}
+	if len(matcher.Sets) == 0 {
+		return errors.New("run: no configuration commands to run")
+	}
+	for _, set := range matcher.Sets {
+		if _, err := deviceCmds(set); err != nil {
+			return fmt.Errorf("run: %v", err)
 		}
 	}
-	if err := s.Err(); err != nil {
-		return fmt.Errorf("run: error scanning %s: %v", cfg.Hosts, err)
+
+	if cfg.Restore && cfg.Backup == "" {
+		return errors.New("run: restore requires a backup directory")
 	}
-	if len(hosts) == 0 {
-		return errors.New("run: no hosts to configure")
+	jobs, jumps, err := newJobs(cfg, hosts)
+	if err != nil {
+		return fmt.Errorf("run: %v", err)
+	}
+	if cfg.Backup != "" {
+		backupDir := filepath.Join(cfg.Backup, time.Now().Format("20060102-150405"))
+		if err := os.MkdirAll(backupDir, 0700); err != nil {
+			return fmt.Errorf("run: could not create backup directory: %v", err)
+		}
+		for i := range jobs {
+			jobs[i].backup = filepath.Join(backupDir, backupName(jobs[i].host))
+			jobs[i].restore = cfg.Restore
+		}
+	}
+
+	results := runJobs(jobs, func(j job) result {
+		return configure(matcher, jumps, j)
+	})
+
+	// read the results
+	failed := 0
+	for i := 0; i < len(hosts); i++ {
+		res, ok := <-results
+		if !ok {
+			return errors.New("run: error reading results, nil channel")
+		}
+		if res.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s error: %v\n", res.host, res.err)
+			if len(res.cmds) == 0 {
+				continue
+			}
+		}
+		report(os.Stdout, res)
+	}
+	if failed > 0 {
+		return fmt.Errorf("run: %d of %d hosts failed", failed, len(hosts))
+	}
+	return nil
+}
+
+// backupName returns the name of the file a host's running config is saved to.
+func backupName(host inventory.Host) string {
+	return strings.NewReplacer(":", "_", "[", "", "]", "", "/", "_").Replace(host.String()) + ".cfg"
+}
+
+// saveConfig saves the running config of a device to a file and returns it.
+func saveConfig(client *device.Client, file string) ([]byte, error) {
+	cfg, err := client.RunningConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(file, append(cfg, '\n'), 0600); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// hostFacts returns what is known about a host to choose its command sets.
+func hostFacts(client *device.Client, host inventory.Host) config.Facts {
+	return config.Facts{
+		Addr:     client.Addr(),
+		Hostname: client.Hostname(),
+		Vendor:   client.Vendor(),
+		OS:       client.OS(),
+		Model:    client.Model(),
+		Version:  client.Version(),
+		Groups:   host.Groups,
+		Vars:     host.Vars,
+	}
+}
+
+// deviceCmds converts the commands of a command set into commands to run on
+// remote devices.
+func deviceCmds(set config.CommandSet) (commands, error) {
+	c := commands{config: set.Mode == "config", mode: device.ConfigMode{Confirm: set.Confirm}}
+	for _, cmd := range set.Cmds {
+		dc, err := deviceCmd(cmd)
+		if err != nil {
+			return c, err
+		}
+		c.cmds = append(c.cmds, dc)
 	}
+	for _, cmd := range set.Check {
+		dc, err := deviceCmd(cmd)
+		if err != nil {
+			return c, err
+		}
+		c.mode.Check = append(c.mode.Check, dc)
+	}
+	return c, nil
+}
 
-	// convert user config commands to map
-	cfgCmds, err := config.MapCmds(cfg)
+// deviceCmd converts a config command into a command to run on remote devices.
+func deviceCmd(cmd config.Cmd) (device.Command, error) {
+	c := device.Command{
+		Cmd:          cmd.Cmd,
+		Answer:       cmd.Answer,
+		Timeout:      cmd.Timeout,
+		IgnoreErrors: cmd.IgnoreErrors,
+	}
+	if cmd.Expect != "" {
+		p, err := regexp.Compile(cmd.Expect)
+		if err != nil {
+			return c, fmt.Errorf("invalid expect for %q: %v", cmd.Cmd, err)
+		}
+		c.Expect = p
+	}
+	return c, nil
+}
+
+// report writes the output, duration and error of each command run on a host.
+func report(w io.Writer, res result) {
+	fmt.Fprintln(w, res.host)
+	for _, out := range res.cmds {
+		fmt.Fprintf(w, "> %s (%v)\n", out.Cmd, out.Duration.Round(time.Millisecond))
+		if len(out.Out) > 0 {
+			fmt.Fprintf(w, "%s\n", out.Out)
+		}
+		if out.Err != nil {
+			fmt.Fprintf(w, "error: %v\n", out.Err)
+		}
+	}
+	fmt.Fprintln(w, strings.Repeat("-", 50))
+}
+
+// newJobs creates a job for each host with the SSH client config and SNMP
+// settings for the host, and returns the jump hosts to reach the hosts
+// through.
+func newJobs(cfg *config.Config, hosts []inventory.Host) ([]job, []device.Jump, error) {
+	clientCfg, err := clientConfig(cfg)
 	if err != nil {
-		return fmt.Errorf("run: could not map commands: %v", err)
+		return nil, nil, err
 	}
-	if len(cfgCmds) == 0 {
-		return errors.New("run: no configuration commands to run")
+	jumps, err := jumpHosts(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, err := device.SNMPSettings()
+	if err != nil {
+		return nil, nil, err
 	}
+	jobs := make([]job, 0, len(hosts))
+	for _, host := range hosts {
+		hostCfg, err := hostClientConfig(cfg, clientCfg, host)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", host, err)
+		}
+		hostSettings, err := hostSNMP(settings, host)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", host, err)
+		}
+		jobs = append(jobs, job{host: host, clientCfg: hostCfg, snmp: hostSettings})
+	}
+	return jobs, jumps, nil
+}
 
+// runJobs runs work for each job in a pool of workers sized by the
+// `--workers` flag and returns a channel of the results, which is closed
+// after the last result.
+func runJobs(jobs []job, work func(job) result) <-chan result {
 	// the network devices to configure and their configuration results
-	devices := make(chan string, len(hosts))
-	results := make(chan result, len(hosts))
+	devices := make(chan job, len(jobs))
+	results := make(chan result, len(jobs))
 
 	// start workers
 	var wg sync.WaitGroup
 	numWorkers := runtime.NumCPU() * workers
 	wg.Add(numWorkers)
 	for w := 0; w < numWorkers; w++ {
-		cfg := cfg
-		cmds := cfgCmds
-		go configure(cmds, cfg, devices, results, &wg)
+		go func() {
+			defer wg.Done()
+			for j := range devices {
+				results <- work(j)
+			}
+		}()
 	}
 	go func() {
 		wg.Wait()
@@ -164,88 +403,83 @@ func runCfg(cfg *config.Config) error {
 	}()
 
 	// send jobs to the workers
-	for _, host := range hosts {
-		devices <- host
+	for _, j := range jobs {
+		devices <- j
 	}
 	close(devices)
+	return results
+}
 
-	// read the results
-	for i := 0; i < len(hosts); i++ {
-		res, ok := <-results
-		if !ok {
-			return errors.New("run: error reading results, nil channel")
-		}
-		if res.err != nil {
-			fmt.Fprintf(os.Stderr, "%s error: %v\n", res.host, res.err)
-			continue
-		}
-		fmt.Printf("%s\n%s\n%s\n", res.host, res.out, strings.Repeat("-", 50))
+// dialHost establishes a client connection to the host of a job, and prints
+// any warnings from discovering the device.
+func dialHost(j job, jumps []device.Jump) (*device.Client, error) {
+	port := j.host.Port
+	if port == "" {
+		port = "22"
 	}
-	return nil
+	client, err := device.DialSNMP(j.host.Addr, port, j.clientCfg, j.snmp, jumps...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %v", j.host, err)
+	}
+	for _, w := range client.Warnings() {
+		fmt.Fprintf(os.Stderr, "%s warning: %v\n", j.host, w)
+	}
+	return client, nil
 }
 
-// configure is a worker that creates a client connection to each host in `devices`
-// then returns the open client connection.
-func configure(cfgCmds map[string][]string, cfg *config.Config, devices <-chan string, results chan<- result, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for host := range devices {
-		cfg := cfg
-		cfgCmds := cfgCmds
+// configure creates a client connection to the host of a job, then runs the
+// command sets that apply to the host.
+func configure(matcher *config.Matcher, jumps []device.Jump, j job) result {
+	// establish client connection to remote device
+	client, err := dialHost(j, jumps)
+	if err != nil {
+		return result{j.host.String(), nil, err}
+	}
+	defer client.Close()
 
-		clientCfg := &ssh.ClientConfig{
-			User:            cfg.User,
-			Auth:            []ssh.AuthMethod{ssh.Password(cfg.Pass)},
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-			Timeout:         cfg.Timeout,
-		}
-		clientCfg.SetDefaults()
-		clientCfg.Ciphers = append(clientCfg.Ciphers, "aes128-cbc", "aes256-cbc", "3des-cbc", "des-cbc", "aes192-cbc")
+	// choose the right command sets to send to the remote device
+	sets := matcher.Match(hostFacts(client, j.host))
+	if len(sets) == 0 {
+		return result{j.host.String(), nil, fmt.Errorf("no commands to run")}
+	}
 
-		// establish client connection to remote device
-		client, err := device.Dial(host, "22", clientCfg)
+	// save the running config before making any changes
+	var saved []byte
+	if j.backup != "" {
+		saved, err = saveConfig(client, j.backup)
 		if err != nil {
-			results <- result{host, nil, fmt.Errorf("failed to dial %s: %v", host, err)}
-			continue
-		}
-
-		// choose the right command set to send to the remote device
-		cmds := make([]string, 0)
-		for k, v := range cfgCmds {
-			m := make(map[string]string)
-			for _, info := range strings.Split(k, ",") {
-				opts := strings.Split(info, ":")
-				opts[0] = strings.TrimSpace(opts[0])
-				opts[1] = strings.Replace(opts[1], `"`, "", -1)
-				m[opts[0]] = strings.TrimSpace(strings.ToLower(opts[1]))
-			}
-			if m["IP Addr"] != "" && m["IP Addr"] != strings.ToLower(client.Addr()) ||
-				m["Hostname"] != "" && m["Hostname"] != strings.ToLower(client.Hostname()) ||
-				m["Vendor"] != "" && m["Vendor"] != strings.ToLower(client.Vendor()) ||
-				m["OS"] != "" && m["OS"] != strings.ToLower(client.OS()) ||
-				m["Model"] != "" && m["Model"] != strings.ToLower(client.Model()) ||
-				m["Version"] != "" && m["Version"] != strings.ToLower(client.Version()) {
-				continue
-			}
-			cmds = v
+			return result{client.String(), nil, fmt.Errorf("failed to back up running config: %v", err)}
 		}
-		if genericCmds, ok := cfgCmds["generic"]; ok && len(cmds) == 0 {
-			cmds = genericCmds
+	}
+
+	// run the commands on the remote device
+	var outs []device.Output
+	for _, set := range sets {
+		var cmds commands
+		if cmds, err = deviceCmds(set); err != nil {
+			break
 		}
-		if len(cmds) == 0 {
-			results <- result{host, nil, fmt.Errorf("no commands to run")}
-			client.Close()
-			continue
+		var setOuts []device.Output
+		if cmds.config {
+			setOuts, err = client.Configure(cmds.mode, cmds.cmds...)
+		} else {
+			setOuts, err = client.RunCommands(cmds.cmds...)
 		}
-
-		// run the commands on the remote device
-		out, err := client.Run(cmds...)
+		outs = append(outs, setOuts...)
 		if err != nil {
-			results <- result{host, nil, fmt.Errorf("failed to run commands: %v", err)}
-			client.Close()
-			continue
+			break
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to run commands: %v", err)
+		if j.restore {
+			if _, rerr := client.Restore(saved); rerr != nil {
+				err = fmt.Errorf("%v; failed to restore %s: %v", err, j.backup, rerr)
+			} else {
+				err = fmt.Errorf("%v; restored %s", err, j.backup)
+			}
 		}
-		results <- result{client.String(), out, nil}
-		client.Close()
+		return result{client.String(), outs, err}
 	}
+	return result{client.String(), outs, nil}
 }
@@ -1 +1,80 @@
 package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwalto7/netcfg/config"
+	"github.com/mwalto7/netcfg/device"
+	"github.com/mwalto7/netcfg/inventory"
+)
+
+func TestReport(t *testing.T) {
+	res := result{
+		host: "switch-1",
+		cmds: []device.Output{
+			{Cmd: "show clock", Out: []byte("12:00:00 UTC"), Duration: 1500 * time.Microsecond},
+			{Cmd: "conf t", Duration: 2 * time.Millisecond},
+			{Cmd: "reload", Duration: 30 * time.Second, Err: errors.New("timed out")},
+		},
+	}
+	want := strings.Join([]string{
+		"switch-1",
+		"> show clock (2ms)",
+		"12:00:00 UTC",
+		"> conf t (2ms)",
+		"> reload (30s)",
+		"error: timed out",
+		strings.Repeat("-", 50),
+		"",
+	}, "\n")
+
+	var buf bytes.Buffer
+	report(&buf, res)
+	if got := buf.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestDeviceCmds(t *testing.T) {
+	set := config.CommandSet{
+		Mode:    "config",
+		Confirm: 5,
+		Check:   []config.Cmd{{Cmd: "show bgp summary"}},
+		Cmds:    []config.Cmd{{Cmd: "copy run start", Expect: "Destination filename", Timeout: time.Minute}},
+	}
+	c, err := deviceCmds(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.config || c.mode.Confirm != 5 || len(c.mode.Check) != 1 || len(c.cmds) != 1 {
+		t.Fatalf("unexpected commands: %+v", c)
+	}
+	if c.cmds[0].Expect == nil || c.cmds[0].Expect.String() != "Destination filename" || c.cmds[0].Timeout != time.Minute {
+		t.Errorf("unexpected command: %+v", c.cmds[0])
+	}
+
+	set = config.CommandSet{Cmds: []config.Cmd{{Cmd: "reload", Expect: "[confirm"}}}
+	if _, err := deviceCmds(set); err == nil {
+		t.Error("expected error for invalid expect")
+	}
+}
+
+func TestBackupName(t *testing.T) {
+	tests := []struct {
+		host inventory.Host
+		want string
+	}{
+		{inventory.Host{Addr: "10.0.0.1"}, "10.0.0.1.cfg"},
+		{inventory.Host{Addr: "10.0.0.1", Port: "2222"}, "10.0.0.1_2222.cfg"},
+		{inventory.Host{Addr: "2001:db8::1", Port: "22"}, "2001_db8__1_22.cfg"},
+	}
+	for _, test := range tests {
+		if got := backupName(test.host); got != test.want {
+			t.Errorf("%v: want %q, got %q", test.host, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwalto7/netcfg/device"
+	"github.com/mwalto7/netcfg/inventory"
+)
+
+// hostSNMP returns the SNMP settings for a host, applying any `snmp_*`
+// variables set for the host or its groups in the inventory to settings. The
+// community and passphrases may be a reference `env:NAME` to read them from
+// the environment variable NAME. Any other `snmp_*` variable is an error, so
+// that a misspelt one is not ignored.
+func hostSNMP(settings device.SNMP, host inventory.Host) (device.SNMP, error) {
+	for key, value := range host.Vars {
+		if !strings.HasPrefix(key, "snmp_") {
+			continue
+		}
+		var err error
+		switch strings.TrimPrefix(key, "snmp_") {
+		case "version":
+			settings.Version = value
+		case "community":
+			settings.Community, err = snmpSecret(value)
+		case "user":
+			settings.User = value
+		case "auth_protocol":
+			settings.AuthProtocol = value
+		case "auth_passphrase":
+			settings.AuthPassphrase, err = snmpSecret(value)
+		case "priv_protocol":
+			settings.PrivProtocol = value
+		case "priv_passphrase":
+			settings.PrivPassphrase, err = snmpSecret(value)
+		case "context":
+			settings.Context = value
+		case "port":
+			settings.Port, err = strconv.Atoi(value)
+		case "retries":
+			settings.Retries, err = strconv.Atoi(value)
+		case "timeout":
+			settings.Timeout, err = time.ParseDuration(value)
+		default:
+			return settings, fmt.Errorf("unknown SNMP variable %s", key)
+		}
+		if err != nil {
+			return settings, fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+	return settings, nil
+}
+
+// snmpSecret resolves an SNMP community or passphrase, which is either the
+// secret itself or "env:NAME" to read it from the environment variable NAME.
+func snmpSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, "env:") {
+		return value, nil
+	}
+	name := strings.TrimPrefix(value, "env:")
+	secret, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return secret, nil
+}
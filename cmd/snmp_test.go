@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mwalto7/netcfg/device"
+	"github.com/mwalto7/netcfg/inventory"
+)
+
+func TestHostSNMP(t *testing.T) {
+	defer func(secret string) { os.Setenv("NETCFG_TEST_SNMP", secret) }(os.Getenv("NETCFG_TEST_SNMP"))
+	os.Setenv("NETCFG_TEST_SNMP", "s3cret")
+
+	settings := device.SNMP{Community: "public"}
+	tests := []struct {
+		name string
+		vars map[string]string
+		ok   bool
+		want device.SNMP
+	}{
+		{"defaults", nil, noError, settings},
+		{"other vars", map[string]string{"role": "core"}, noError, settings},
+		{
+			name: "version 2c",
+			vars: map[string]string{"snmp_community": "private", "snmp_port": "1161", "snmp_retries": "2", "snmp_timeout": "10s"},
+			ok:   noError,
+			want: device.SNMP{Community: "private", Port: 1161, Retries: 2, Timeout: 10 * time.Second},
+		},
+		{
+			name: "version 3",
+			vars: map[string]string{
+				"snmp_version":         "3",
+				"snmp_user":            "netcfg",
+				"snmp_auth_protocol":   "SHA",
+				"snmp_auth_passphrase": "env:NETCFG_TEST_SNMP",
+				"snmp_priv_protocol":   "AES",
+				"snmp_priv_passphrase": "privpass",
+				"snmp_context":         "vlan-10",
+			},
+			ok: noError,
+			want: device.SNMP{
+				Version:        "3",
+				Community:      "public",
+				User:           "netcfg",
+				AuthProtocol:   "SHA",
+				AuthPassphrase: "s3cret",
+				PrivProtocol:   "AES",
+				PrivPassphrase: "privpass",
+				Context:        "vlan-10",
+			},
+		},
+		{"env community", map[string]string{"snmp_community": "env:NETCFG_TEST_SNMP"}, noError, device.SNMP{Community: "s3cret"}},
+		{"unset env community", map[string]string{"snmp_community": "env:NETCFG_TEST_UNSET"}, hasError, device.SNMP{}},
+		{"bad port", map[string]string{"snmp_port": "snmp"}, hasError, device.SNMP{}},
+		{"bad timeout", map[string]string{"snmp_timeout": "10"}, hasError, device.SNMP{}},
+		{"unknown var", map[string]string{"snmp_comunity": "private"}, hasError, device.SNMP{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := hostSNMP(settings, inventory.Host{Addr: "10.0.0.1", Vars: test.vars})
+			switch {
+			case err != nil && test.ok:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !test.ok:
+				t.Fatal("expected error, got none")
+			case err != nil && !test.ok:
+				t.Logf("got expected error: %v", err)
+				return
+			}
+			if got != test.want {
+				t.Errorf("want %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,523 @@
+// Copyright © 2018 Mason Walton <dev.mwalto7@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/mwalto7/netcfg/config"
+	"github.com/mwalto7/netcfg/device"
+	"github.com/mwalto7/netcfg/inventory"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// defaultKnownHosts is the OpenSSH known_hosts file used by `accept: known_hosts`.
+	defaultKnownHosts = "~/.ssh/known_hosts"
+
+	// defaultTOFUHosts is the netcfg managed known hosts file used by `accept: tofu`.
+	defaultTOFUHosts = "~/.netcfg_known_hosts"
+)
+
+var (
+	// readPassphrase prompts for the passphrase of an encrypted private key.
+	readPassphrase = func(key string) ([]byte, error) {
+		return readSecret(fmt.Sprintf("Passphrase for %s: ", key))
+	}
+
+	// readPassword prompts for the password of a host.
+	readPassword = func(host string) ([]byte, error) {
+		return readSecret(fmt.Sprintf("Password for %s: ", host))
+	}
+)
+
+// keyCache caches loaded private keys by path so that the passphrase for an
+// encrypted key is only prompted for once.
+var keyCache = struct {
+	sync.Mutex
+	m map[string]ssh.Signer
+}{m: make(map[string]ssh.Signer)}
+
+// agentCache caches the connections to ssh-agent by socket so that every
+// host shares one connection.
+var agentCache = struct {
+	sync.Mutex
+	m map[string]agent.ExtendedAgent
+}{m: make(map[string]agent.ExtendedAgent)}
+
+// readSecret prompts for a secret without echoing it to the terminal.
+func readSecret(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr)
+	return secret, nil
+}
+
+// clientConfig creates the SSH client configuration used to connect to hosts.
+func clientConfig(cfg *config.Config) (*ssh.ClientConfig, error) {
+	auth, err := authMethods(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := hostKeyCallback(cfg.Accept, cfg.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+	clientCfg := &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         cfg.Timeout,
+	}
+	clientCfg.SetDefaults()
+	clientCfg.Ciphers = append(clientCfg.Ciphers, "aes128-cbc", "aes256-cbc", "3des-cbc", "des-cbc", "aes192-cbc")
+	return clientCfg, nil
+}
+
+// authMethods returns the SSH authentication methods for a config. Public key
+// authentication is tried first with the keys held by ssh-agent if `agent` is
+// set and every key (and certificate) in `keys`, and password authentication
+// is used as a backup only if `pass` is set.
+func authMethods(cfg *config.Config) ([]ssh.AuthMethod, error) {
+	var signers []ssh.Signer
+	for _, key := range cfg.Keys {
+		signer, err := loadKey(key.Path)
+		if err != nil {
+			return nil, err
+		}
+		if key.Cert != "" {
+			certSigner, err := loadCert(key.Cert, signer)
+			if err != nil {
+				return nil, err
+			}
+			signers = append(signers, certSigner)
+		}
+		signers = append(signers, signer)
+	}
+
+	var auth []ssh.AuthMethod
+	switch {
+	case cfg.Agent:
+		keyring, err := dialAgent()
+		if err != nil {
+			return nil, err
+		}
+		// the client only tries each method once, so the agent and
+		// file signers must be offered by the same method
+		auth = append(auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			agentSigners, err := keyring.Signers()
+			if err != nil {
+				return nil, fmt.Errorf("could not get keys from ssh-agent: %v", err)
+			}
+			return append(agentSigners, signers...), nil
+		}))
+	case len(signers) > 0:
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if cfg.Pass != "" {
+		auth = append(auth, ssh.Password(cfg.Pass))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("no authentication methods, set `pass`, `keys` or `agent`")
+	}
+	return auth, nil
+}
+
+// dialAgent connects to the ssh-agent listening on SSH_AUTH_SOCK. The
+// connection is made once and stays open for the life of the program so that
+// the agent can sign authentication requests for every host.
+func dialAgent() (agent.ExtendedAgent, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("could not connect to ssh-agent: SSH_AUTH_SOCK is not set")
+	}
+	agentCache.Lock()
+	defer agentCache.Unlock()
+	if keyring, ok := agentCache.m[sock]; ok {
+		return keyring, nil
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to ssh-agent: %v", err)
+	}
+	keyring := agent.NewClient(conn)
+	agentCache.m[sock] = keyring
+	return keyring, nil
+}
+
+// loadCert reads an OpenSSH certificate from a file and returns a signer that
+// authenticates with the certificate and the private key it was issued for.
+func loadCert(cert string, signer ssh.Signer) (ssh.Signer, error) {
+	path, err := homedir.Expand(cert)
+	if err != nil {
+		return nil, fmt.Errorf("could not expand certificate path %s: %v", cert, err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read certificate %s: %v", cert, err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse certificate %s: %v", cert, err)
+	}
+	c, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", cert)
+	}
+	certSigner, err := ssh.NewCertSigner(c, signer)
+	if err != nil {
+		return nil, fmt.Errorf("could not use certificate %s: %v", cert, err)
+	}
+	return certSigner, nil
+}
+
+// loadKey reads an SSH private key from a file, prompting for its passphrase
+// if the key is encrypted.
+func loadKey(key string) (ssh.Signer, error) {
+	path, err := homedir.Expand(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not expand key path %s: %v", key, err)
+	}
+	keyCache.Lock()
+	defer keyCache.Unlock()
+	if signer, ok := keyCache.m[path]; ok {
+		return signer, nil
+	}
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key %s: %v", key, err)
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		passphrase, err := readPassphrase(key)
+		if err != nil {
+			return nil, fmt.Errorf("could not read passphrase for %s: %v", key, err)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("could not decrypt key %s: %v", key, err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("could not parse key %s: %v", key, err)
+	}
+	keyCache.m[path] = signer
+	return signer, nil
+}
+
+// hostClientConfig returns the SSH client configuration for a host, applying
+// any connection parameters set for the host in the hosts file to clientCfg.
+// A host with known keys is only asked for host keys of their types.
+func hostClientConfig(cfg *config.Config, clientCfg *ssh.ClientConfig, host inventory.Host) (*ssh.ClientConfig, error) {
+	port := host.Port
+	if port == "" {
+		port = "22"
+	}
+	algos, err := knownHostKeyAlgorithms(cfg.Accept, cfg.KnownHosts, net.JoinHostPort(host.Addr, port))
+	if err != nil {
+		return nil, err
+	}
+	if host.User == "" && host.Pass == "" && len(host.Keys) == 0 && host.Timeout == 0 && len(algos) == 0 {
+		return clientCfg, nil
+	}
+	hostCfg := *clientCfg
+	hostCfg.HostKeyAlgorithms = algos
+	if host.User != "" {
+		hostCfg.User = host.User
+	}
+	if host.Timeout != 0 {
+		hostCfg.Timeout = host.Timeout
+	}
+	if host.Pass != "" || len(host.Keys) > 0 {
+		authCfg := &config.Config{Pass: cfg.Pass, Keys: cfg.Keys, Agent: cfg.Agent}
+		if host.Pass != "" {
+			pass, err := hostPass(host)
+			if err != nil {
+				return nil, err
+			}
+			authCfg.Pass = pass
+		}
+		if len(host.Keys) > 0 {
+			authCfg.Keys = make([]config.Key, len(host.Keys))
+			for i, key := range host.Keys {
+				authCfg.Keys[i] = config.Key{Path: key}
+			}
+		}
+		auth, err := authMethods(authCfg)
+		if err != nil {
+			return nil, err
+		}
+		hostCfg.Auth = auth
+	}
+	return &hostCfg, nil
+}
+
+// hostPass resolves the password reference of a host. The reference is
+// either "env:NAME" to read the password from the environment variable NAME,
+// or "prompt" to prompt for the password.
+func hostPass(host inventory.Host) (string, error) {
+	switch {
+	case strings.HasPrefix(host.Pass, "env:"):
+		name := strings.TrimPrefix(host.Pass, "env:")
+		pass, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("password environment variable %s is not set", name)
+		}
+		return pass, nil
+	case host.Pass == "prompt":
+		pass, err := readPassword(host.String())
+		if err != nil {
+			return "", fmt.Errorf("could not read password: %v", err)
+		}
+		return string(pass), nil
+	default:
+		return "", fmt.Errorf("expected pass to be 'env:NAME' or 'prompt', got %q", host.Pass)
+	}
+}
+
+// jumpHosts returns the jump hosts of a config for use with `device.Dial`.
+// A jump host without a user logs in with the user of the config, and a jump
+// host without `accept` checks its host key with the `accept` and
+// `known_hosts` of the config.
+func jumpHosts(cfg *config.Config) ([]device.Jump, error) {
+	jumps := make([]device.Jump, 0, len(cfg.Jump))
+	for _, j := range cfg.Jump {
+		if j.Host == "" {
+			return nil, errors.New("jump host is missing `host`")
+		}
+		user := j.User
+		if user == "" {
+			user = cfg.User
+		}
+		port := j.Port
+		if port == 0 {
+			port = 22
+		}
+		accept, knownHosts := j.Accept, j.KnownHosts
+		if accept == "" {
+			accept = cfg.Accept
+		}
+		if knownHosts == "" && accept == cfg.Accept {
+			knownHosts = cfg.KnownHosts
+		}
+		clientCfg, err := clientConfig(&config.Config{
+			User:       user,
+			Pass:       j.Pass,
+			Keys:       j.Keys,
+			Agent:      j.Agent,
+			Accept:     accept,
+			KnownHosts: knownHosts,
+			Timeout:    cfg.Timeout,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("jump host %s: %v", j.Host, err)
+		}
+		addr := net.JoinHostPort(j.Host, strconv.Itoa(port))
+		if clientCfg.HostKeyAlgorithms, err = knownHostKeyAlgorithms(accept, knownHosts, addr); err != nil {
+			return nil, fmt.Errorf("jump host %s: %v", j.Host, err)
+		}
+		jumps = append(jumps, device.Jump{Addr: addr, Config: clientCfg})
+	}
+	return jumps, nil
+}
+
+// hostKeyCallback returns the host key policy for the `accept` option.
+//
+// "all" (or no value) accepts any host key. "known_hosts" only accepts hosts
+// whose keys are found in the OpenSSH known_hosts file. "tofu" trusts a host
+// key the first time it is seen, records it, and rejects any later change.
+// If file is empty the default file for the policy is used.
+func hostKeyCallback(accept, file string) (ssh.HostKeyCallback, error) {
+	switch accept {
+	case "", "all":
+		return ssh.InsecureIgnoreHostKey(), nil
+	case "known_hosts":
+		path, err := knownHostsPath(accept, file)
+		if err != nil {
+			return nil, err
+		}
+		callback, err := knownhosts.New(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read known hosts file %s: %v", path, err)
+		}
+		return checkKnownHosts(callback, path), nil
+	case "tofu":
+		path, err := knownHostsPath(accept, file)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("could not open known hosts file %s: %v", path, err)
+		}
+		f.Close()
+		return (&tofu{path: path}).check, nil
+	default:
+		return nil, fmt.Errorf("expected `accept` to be 'all', 'known_hosts' or 'tofu', got %q", accept)
+	}
+}
+
+// knownHostsPath returns the path of the known hosts file of the `accept`
+// option, or "" if the option does not check host keys. If file is empty the
+// default file for the policy is used.
+func knownHostsPath(accept, file string) (string, error) {
+	switch accept {
+	case "known_hosts":
+		if file == "" {
+			file = defaultKnownHosts
+		}
+	case "tofu":
+		if file == "" {
+			file = defaultTOFUHosts
+		}
+	default:
+		return "", nil
+	}
+	path, err := homedir.Expand(file)
+	if err != nil {
+		return "", fmt.Errorf("could not expand known hosts path %s: %v", file, err)
+	}
+	return path, nil
+}
+
+// hostKeyAlgorithms are the host key algorithms that verify keys of each
+// type, if not only the algorithm named for the type.
+var hostKeyAlgorithms = map[string][]string{
+	ssh.KeyAlgoRSA: {"rsa-sha2-512", "rsa-sha2-256", ssh.KeyAlgoRSA},
+}
+
+// unknownKey is a host key that is in no known hosts file.
+type unknownKey struct{}
+
+func (unknownKey) Type() string                        { return "unknown" }
+func (unknownKey) Marshal() []byte                     { return nil }
+func (unknownKey) Verify([]byte, *ssh.Signature) error { return errors.New("unknown key") }
+
+// knownHostKeyAlgorithms returns the host key algorithms of the keys of a
+// host in the known hosts file of the `accept` option, so that a host with
+// keys of several types is asked for one that can be verified. It returns no
+// algorithms if the host has no known keys.
+func knownHostKeyAlgorithms(accept, file, hostport string) ([]string, error) {
+	path, err := knownHostsPath(accept, file)
+	if err != nil || path == "" {
+		return nil, err
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		// the host key callback reports the file as unreadable
+		return nil, nil
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, err
+	}
+	remote := &net.TCPAddr{IP: net.ParseIP(host)}
+	if remote.IP == nil {
+		remote.IP = net.IPv4zero
+	}
+	remote.Port, _ = strconv.Atoi(port)
+
+	keyErr, ok := callback(hostport, remote, unknownKey{}).(*knownhosts.KeyError)
+	if !ok {
+		return nil, nil
+	}
+	var algos []string
+	seen := make(map[string]bool)
+	for _, known := range keyErr.Want {
+		keyAlgos, ok := hostKeyAlgorithms[known.Key.Type()]
+		if !ok {
+			keyAlgos = []string{known.Key.Type()}
+		}
+		for _, algo := range keyAlgos {
+			if !seen[algo] {
+				seen[algo] = true
+				algos = append(algos, algo)
+			}
+		}
+	}
+	return algos, nil
+}
+
+// checkKnownHosts wraps a known_hosts callback to explain why a host key was rejected.
+func checkKnownHosts(callback ssh.HostKeyCallback, path string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return hostKeyError(hostname, path, key, callback(hostname, remote, key))
+	}
+}
+
+// hostKeyError converts a known_hosts error into a clear per-host error.
+func hostKeyError(hostname, path string, key ssh.PublicKey, err error) error {
+	keyErr, ok := err.(*knownhosts.KeyError)
+	if !ok {
+		return err
+	}
+	if len(keyErr.Want) == 0 {
+		return fmt.Errorf("host key for %s is unknown, %s not found in %s", hostname, ssh.FingerprintSHA256(key), path)
+	}
+	want := keyErr.Want[0]
+	return fmt.Errorf("host key for %s has changed, expected key at %s:%d (possible man-in-the-middle attack)", hostname, want.Filename, want.Line)
+}
+
+// tofu is a trust on first use host key policy backed by a known hosts file.
+type tofu struct {
+	mu   sync.Mutex // guards the known hosts file
+	path string     // path to the known hosts file
+}
+
+// check checks a host key against the known hosts file and records the keys
+// of hosts that have not been seen before.
+func (t *tofu) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	callback, err := knownhosts.New(t.path)
+	if err != nil {
+		return fmt.Errorf("could not read known hosts file %s: %v", t.path, err)
+	}
+	err = callback(hostname, remote, key)
+	if keyErr, ok := err.(*knownhosts.KeyError); ok && len(keyErr.Want) == 0 {
+		f, err := os.OpenFile(t.path, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("could not open known hosts file %s: %v", t.path, err)
+		}
+		defer f.Close()
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+		return err
+	}
+	return hostKeyError(hostname, t.path, key, err)
+}
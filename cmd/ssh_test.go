@@ -0,0 +1,561 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/mwalto7/netcfg/config"
+	"github.com/mwalto7/netcfg/inventory"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	noError  = true
+	hasError = false
+)
+
+// writeKey generates an ed25519 private key and writes it to dir, encrypted
+// with passphrase if it is not empty.
+func writeKey(t *testing.T, dir, name, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, sshPub
+}
+
+func TestLoadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netcfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(f func(string) ([]byte, error)) { readPassphrase = f }(readPassphrase)
+	readPassphrase = func(string) ([]byte, error) { return []byte("testing123"), nil }
+
+	tests := []struct {
+		name       string
+		passphrase string
+		ok         bool
+	}{
+		{"plain", "", noError},
+		{"encrypted", "testing123", noError},
+		{"wrong passphrase", "wrong", hasError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, pub := writeKey(t, dir, test.name, test.passphrase)
+			signer, err := loadKey(path)
+			switch {
+			case err != nil && test.ok:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !test.ok:
+				t.Fatal("expected error, got none")
+			case err != nil && !test.ok:
+				t.Logf("got expected error: %v", err)
+				return
+			}
+			if string(signer.PublicKey().Marshal()) != string(pub.Marshal()) {
+				t.Error("public keys do not match")
+			}
+		})
+	}
+
+	if _, err := loadKey(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing key, got none")
+	}
+}
+
+func TestAuthMethods(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netcfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, _ := writeKey(t, dir, "id_ed25519", "")
+
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		want int
+		ok   bool
+	}{
+		{"none", &config.Config{}, 0, hasError},
+		{"password", &config.Config{Pass: "password"}, 1, noError},
+		{"keys", &config.Config{Keys: []config.Key{{Path: key}}}, 1, noError},
+		{"keys and password", &config.Config{Keys: []config.Key{{Path: key}}, Pass: "password"}, 2, noError},
+		{"bad key", &config.Config{Keys: []config.Key{{Path: filepath.Join(dir, "missing")}}, Pass: "password"}, 0, hasError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := authMethods(test.cfg)
+			switch {
+			case err != nil && test.ok:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !test.ok:
+				t.Fatal("expected error, got none")
+			}
+			if len(auth) != test.want {
+				t.Errorf("want %d auth methods, got %d", test.want, len(auth))
+			}
+		})
+	}
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netcfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, key := writeKey(t, dir, "host1", "")
+	_, other := writeKey(t, dir, "host2", "")
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.HashHostname("10.0.0.1")}, key)
+	if err := ioutil.WriteFile(knownHostsFile, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("all", func(t *testing.T) {
+		callback, err := hostKeyCallback("all", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := callback("10.0.0.1:22", remote, other); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("known_hosts", func(t *testing.T) {
+		callback, err := hostKeyCallback("known_hosts", knownHostsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := callback("10.0.0.1:22", remote, key); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		err = callback("10.0.0.1:22", remote, other)
+		if err == nil || !strings.Contains(err.Error(), "has changed") {
+			t.Errorf("want changed key error, got %v", err)
+		}
+		unknown := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 22}
+		err = callback("10.0.0.2:22", unknown, key)
+		if err == nil || !strings.Contains(err.Error(), "is unknown") {
+			t.Errorf("want unknown key error, got %v", err)
+		}
+	})
+
+	t.Run("tofu", func(t *testing.T) {
+		file := filepath.Join(dir, "tofu", "known_hosts")
+		callback, err := hostKeyCallback("tofu", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := callback("10.0.0.1:22", remote, key); err != nil {
+			t.Errorf("unexpected error on first use: %v", err)
+		}
+		if err := callback("10.0.0.1:22", remote, key); err != nil {
+			t.Errorf("unexpected error on second use: %v", err)
+		}
+		err = callback("10.0.0.1:22", remote, other)
+		if err == nil || !strings.Contains(err.Error(), "has changed") {
+			t.Errorf("want changed key error, got %v", err)
+		}
+	})
+
+	t.Run("default file", func(t *testing.T) {
+		defer func(home string) { os.Setenv("HOME", home) }(os.Getenv("HOME"))
+		defer func(disable bool) { homedir.DisableCache = disable }(homedir.DisableCache)
+		os.Setenv("HOME", dir)
+		homedir.DisableCache = true
+
+		want := filepath.Join(dir, ".ssh", "known_hosts")
+		_, err := hostKeyCallback("known_hosts", "")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("want error naming %s, got %v", want, err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := hostKeyCallback("none", ""); err == nil {
+			t.Error("expected error, got none")
+		}
+	})
+}
+
+func TestKnownHostKeyAlgorithms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netcfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, key := writeKey(t, dir, "host1", "")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	lines := knownhosts.Line([]string{knownhosts.HashHostname("10.0.0.1")}, key) + "\n" +
+		knownhosts.Line([]string{"[10.0.0.2]:2222"}, other) + "\n"
+	if err := ioutil.WriteFile(knownHostsFile, []byte(lines), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		accept string
+		host   inventory.Host
+		want   []string
+	}{
+		{"known key", "known_hosts", inventory.Host{Addr: "10.0.0.1"}, []string{ssh.KeyAlgoED25519}},
+		{"rsa key", "known_hosts", inventory.Host{Addr: "10.0.0.2", Port: "2222"}, []string{"rsa-sha2-512", "rsa-sha2-256", ssh.KeyAlgoRSA}},
+		{"other port", "known_hosts", inventory.Host{Addr: "10.0.0.2"}, nil},
+		{"unknown host", "known_hosts", inventory.Host{Addr: "10.0.0.3"}, nil},
+		{"no check", "all", inventory.Host{Addr: "10.0.0.1"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{Accept: test.accept, KnownHosts: knownHostsFile}
+			got, err := hostClientConfig(cfg, &ssh.ClientConfig{}, test.host)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got.HostKeyAlgorithms, test.want) {
+				t.Errorf("want host key algorithms %v, got %v", test.want, got.HostKeyAlgorithms)
+			}
+		})
+	}
+}
+
+// serveSSH starts a local SSH server that authenticates users with the
+// public key callback and returns its address.
+func serveSSH(t *testing.T, callback func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error)) string {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCfg := &ssh.ServerConfig{PublicKeyCallback: callback}
+	serverCfg.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sconn, chans, reqs, err := ssh.NewServerConn(conn, serverCfg)
+				if err != nil {
+					return
+				}
+				defer sconn.Close()
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestAuthMethods_Agent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netcfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	var conns int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	defer func(sock string) { os.Setenv("SSH_AUTH_SOCK", sock) }(os.Getenv("SSH_AUTH_SOCK"))
+	os.Setenv("SSH_AUTH_SOCK", sock)
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveSSH(t, func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if string(key.Marshal()) == string(signer.PublicKey().Marshal()) {
+			return nil, nil
+		}
+		return nil, errors.New("unknown key")
+	})
+
+	clientCfg, err := clientConfig(&config.Config{User: "user", Agent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ssh.Dial("tcp", addr, clientCfg)
+	if err != nil {
+		t.Fatalf("could not authenticate with ssh-agent: %v", err)
+	}
+	client.Close()
+
+	// every host shares the connection to the agent
+	defer func(pass string) { os.Setenv("NETCFG_TEST_PASS", pass) }(os.Getenv("NETCFG_TEST_PASS"))
+	os.Setenv("NETCFG_TEST_PASS", "secret")
+	cfg := &config.Config{User: "user", Agent: true}
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2"} {
+		if _, err := hostClientConfig(cfg, clientCfg, inventory.Host{Addr: addr, Pass: "env:NETCFG_TEST_PASS"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("want 1 connection to ssh-agent, got %d", n)
+	}
+
+	os.Setenv("SSH_AUTH_SOCK", "")
+	if _, err := authMethods(&config.Config{Agent: true}); err == nil {
+		t.Error("expected error without SSH_AUTH_SOCK, got none")
+	}
+}
+
+func TestAuthMethods_Cert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netcfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, pub := writeKey(t, dir, "id_ed25519", "")
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"user"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	certFile := key + "-cert.pub"
+	if err := ioutil.WriteFile(certFile, ssh.MarshalAuthorizedKey(cert), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(ca.PublicKey().Marshal())
+		},
+	}
+	addr := serveSSH(t, func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if _, ok := key.(*ssh.Certificate); !ok {
+			return nil, errors.New("certificate required")
+		}
+		return checker.Authenticate(conn, key)
+	})
+
+	clientCfg, err := clientConfig(&config.Config{User: "user", Keys: []config.Key{{Path: key, Cert: certFile}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ssh.Dial("tcp", addr, clientCfg)
+	if err != nil {
+		t.Fatalf("could not authenticate with certificate: %v", err)
+	}
+	client.Close()
+
+	if _, err := authMethods(&config.Config{Keys: []config.Key{{Path: key, Cert: key}}}); err == nil {
+		t.Error("expected error for invalid certificate, got none")
+	}
+}
+
+func TestHostClientConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netcfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, _ := writeKey(t, dir, "id_ed25519", "")
+
+	defer func(pass string) { os.Setenv("NETCFG_TEST_PASS", pass) }(os.Getenv("NETCFG_TEST_PASS"))
+	os.Setenv("NETCFG_TEST_PASS", "secret")
+	defer func(f func(string) ([]byte, error)) { readPassword = f }(readPassword)
+	readPassword = func(string) ([]byte, error) { return []byte("secret"), nil }
+
+	cfg := &config.Config{User: "user", Pass: "password", Timeout: 10 * time.Second}
+	clientCfg, err := clientConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		host    inventory.Host
+		ok      bool
+		user    string
+		timeout time.Duration
+		auth    int
+	}{
+		{"defaults", inventory.Host{Addr: "10.0.0.1"}, noError, "user", 10 * time.Second, 1},
+		{"user and timeout", inventory.Host{Addr: "10.0.0.1", User: "admin", Timeout: time.Minute}, noError, "admin", time.Minute, 1},
+		{"env pass", inventory.Host{Addr: "10.0.0.1", Pass: "env:NETCFG_TEST_PASS"}, noError, "user", 10 * time.Second, 1},
+		{"prompt pass", inventory.Host{Addr: "10.0.0.1", Pass: "prompt"}, noError, "user", 10 * time.Second, 1},
+		{"keys", inventory.Host{Addr: "10.0.0.1", Keys: []string{key}}, noError, "user", 10 * time.Second, 2},
+		{"unset env pass", inventory.Host{Addr: "10.0.0.1", Pass: "env:NETCFG_TEST_UNSET"}, hasError, "", 0, 0},
+		{"plain pass", inventory.Host{Addr: "10.0.0.1", Pass: "password"}, hasError, "", 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := hostClientConfig(cfg, clientCfg, test.host)
+			switch {
+			case err != nil && test.ok:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !test.ok:
+				t.Fatal("expected error, got none")
+			case err != nil && !test.ok:
+				t.Logf("got expected error: %v", err)
+				return
+			}
+			if got.User != test.user {
+				t.Errorf("want user %s, got %s", test.user, got.User)
+			}
+			if got.Timeout != test.timeout {
+				t.Errorf("want timeout %v, got %v", test.timeout, got.Timeout)
+			}
+			if len(got.Auth) != test.auth {
+				t.Errorf("want %d auth methods, got %d", test.auth, len(got.Auth))
+			}
+		})
+	}
+	if clientCfg.User != "user" || clientCfg.Timeout != 10*time.Second {
+		t.Error("shared client config was modified")
+	}
+}
+
+func TestJumpHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netcfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, key := writeKey(t, dir, "bastion", "")
+	_, other := writeKey(t, dir, "other", "")
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{"10.0.0.1"}, key)
+	if err := ioutil.WriteFile(knownHostsFile, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		jump   config.JumpHost
+		user   string
+		strict bool
+	}{
+		{"inherit", config.JumpHost{Host: "10.0.0.1", Pass: "password"}, "user", true},
+		{"own user", config.JumpHost{Host: "10.0.0.1", User: "admin", Pass: "password"}, "admin", true},
+		{"own accept", config.JumpHost{Host: "10.0.0.1", Pass: "password", Accept: "all"}, "user", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jumps, err := jumpHosts(&config.Config{
+				User:       "user",
+				Accept:     "known_hosts",
+				KnownHosts: knownHostsFile,
+				Jump:       []config.JumpHost{test.jump},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jumps) != 1 || jumps[0].Addr != "10.0.0.1:22" {
+				t.Fatalf("want jump host 10.0.0.1:22, got %v", jumps)
+			}
+			got := jumps[0].Config
+			if got.User != test.user {
+				t.Errorf("want user %s, got %s", test.user, got.User)
+			}
+			if err := got.HostKeyCallback("10.0.0.1:22", remote, key); err != nil {
+				t.Errorf("unexpected error for known key: %v", err)
+			}
+			if err := got.HostKeyCallback("10.0.0.1:22", remote, other); (err != nil) != test.strict {
+				t.Errorf("want host key checked %t, got %v", test.strict, err)
+			}
+		})
+	}
+}
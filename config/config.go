@@ -6,35 +6,89 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"reflect"
+	"regexp"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
 // cmdSet is the set of configurations commands to be run.
 type cmdSet struct {
-	Addr     string      `yaml:"addr"`     // commands apply to this IP address
-	Hostname string      `yaml:"hostname"` // commands apply to this hostname
-	Vendor   string      `yaml:"vendor"`   // commands apply to this vendor
-	OS       string      `yaml:"os"`       // commands apply to this operating system
-	Models   []string    `yaml:"models"`   // commands apply to these models
-	Version  string      `yaml:"version"`  // commands apply to this software version
-	Cmds     interface{} `yaml:"cmds"`     // configuration commands to run
+	Addr     string            `yaml:"addr"`     // commands apply to this IP address
+	Hostname string            `yaml:"hostname"` // commands apply to this hostname
+	Vendor   string            `yaml:"vendor"`   // commands apply to this vendor
+	OS       string            `yaml:"os"`       // commands apply to this operating system
+	Models   []string          `yaml:"models"`   // commands apply to these models
+	Version  string            `yaml:"version"`  // commands apply to this software version
+	Groups   []string          `yaml:"groups"`   // commands apply to hosts in these inventory groups
+	Vars     map[string]string `yaml:"vars"`     // commands apply to hosts with these inventory variables
+	Priority int               `yaml:"priority"` // commands with a higher priority are chosen over more specific ones
+	Mode     string            `yaml:"mode"`     // mode to run the commands in, "config" for configuration mode
+	Confirm  int               `yaml:"confirm"`  // minutes until a commit is rolled back unless confirmed
+	Check    interface{}       `yaml:"check"`    // commands that must not fail to confirm a commit
+	Cmds     interface{}       `yaml:"cmds"`     // configuration commands to run
+}
+
+// Cmd is a configuration command. A command may be written in a config as a
+// string, or as a mapping with the command and options for running it.
+type Cmd struct {
+	Cmd          string        `yaml:"cmd" mapstructure:"cmd"`                     // command to run
+	Expect       string        `yaml:"expect" mapstructure:"expect"`               // regular expression of a prompt to answer
+	Answer       string        `yaml:"answer" mapstructure:"answer"`               // answer sent when the expected prompt appears
+	Timeout      time.Duration `yaml:"timeout" mapstructure:"timeout"`             // time to wait for the command to finish
+	IgnoreErrors bool          `yaml:"ignore_errors" mapstructure:"ignore_errors"` // errors from the command do not fail the host
+}
+
+// String returns the command of a Cmd.
+func (c Cmd) String() string {
+	return c.Cmd
+}
+
+// Key is an SSH private key used for authentication. A key may be written in
+// a config as a path to the private key, or as a mapping with the path to the
+// private key and the path to its signed OpenSSH certificate.
+type Key struct {
+	Path string `yaml:"key" mapstructure:"key"`   // path to the private key
+	Cert string `yaml:"cert" mapstructure:"cert"` // path to the certificate for the key
+}
+
+// JumpHost is an SSH jump host (bastion) used to reach the hosts in a config.
+type JumpHost struct {
+	Host       string `yaml:"host"`                                   // address of the jump host
+	Port       int    `yaml:"port"`                                   // ssh port of the jump host
+	User       string `yaml:"user"`                                   // username for jump host login
+	Pass       string `yaml:"pass"`                                   // password for jump host login
+	Keys       []Key  `yaml:"keys"`                                   // ssh private keys for authentication
+	Agent      bool   `yaml:"agent"`                                  // use ssh-agent for authentication
+	Accept     string `yaml:"accept"`                                 // host key policy for the jump host
+	KnownHosts string `yaml:"known_hosts" mapstructure:"known_hosts"` // known hosts file for `accept`
 }
 
 // Config represents a `netcfg` configuration file.
 type Config struct {
-	Hosts   string        `yaml:"hosts"`   // file of hosts to configure
-	User    string        `yaml:"user"`    // username for host login
-	Pass    string        `yaml:"pass"`    // password for host login
-	Keys    []string      `yaml:"keys"`    // ssh private keys for authentication
-	Accept  string        `yaml:"accept"`  // group of hosts to accept connections to
-	Timeout time.Duration `yaml:"timeout"` // time to wait to establish an ssh client connection
-	Aliases []cmdSet      `yaml:"aliases"` // aliases for configuration command sets
-	Config  []cmdSet      `yaml:"config"`  // sets of configuration commands to run
+	Hosts        string        `yaml:"hosts"`                                      // file of hosts to configure
+	Inventory    string        `yaml:"inventory"`                                  // format of the hosts file, "netcfg" or "ansible"
+	User         string        `yaml:"user"`                                       // username for host login
+	Pass         string        `yaml:"pass"`                                       // password for host login
+	EnableSecret string        `yaml:"enable_secret" mapstructure:"enable_secret"` // password for privileged mode
+	Keys         []Key         `yaml:"keys"`                                       // ssh private keys for authentication
+	Agent        bool          `yaml:"agent"`                                      // use ssh-agent for authentication
+	Accept       string        `yaml:"accept"`                                     // group of hosts to accept connections to
+	KnownHosts   string        `yaml:"known_hosts" mapstructure:"known_hosts"`     // known hosts file for `accept`
+	Timeout      time.Duration `yaml:"timeout"`                                    // time to wait to establish an ssh client connection
+	Jump         []JumpHost    `yaml:"jump"`                                       // jump hosts to tunnel through, in order
+	Errors       []string      `yaml:"errors"`                                     // regular expressions that match command errors
+	StopOnError  bool          `yaml:"stop_on_error" mapstructure:"stop_on_error"` // stop running a host's commands after an error
+	Backup       string        `yaml:"backup"`                                     // directory to save the running config of each host to before running commands
+	Restore      bool          `yaml:"restore"`                                    // restore the saved running config of a host when running its commands fails
+	MatchAll     bool          `yaml:"match_all" mapstructure:"match_all"`         // run every command set that applies to a host instead of the most specific one
+	Aliases      []cmdSet      `yaml:"aliases"`                                    // aliases for configuration command sets
+	Config       []cmdSet      `yaml:"config"`                                     // sets of configuration commands to run
 
 	name string // name of this config
 	data string // template data for this config
@@ -85,12 +139,68 @@ func (c *Config) Parse(src string) (*Config, error) {
 	}
 	c.text = buf.String()
 
-	if err := v.Unmarshal(c); err != nil {
+	if err := decode(v.AllSettings(), c); err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
+// decode decodes the settings of a parsed config into a Config.
+func decode(settings map[string]interface{}, c *Config) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           c,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			stringToKeyHookFunc,
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
+	if err != nil {
+		return err
+	}
+	return dec.Decode(settings)
+}
+
+// toCmd converts a command written as a string or a mapping into a Cmd.
+func toCmd(v interface{}) (Cmd, error) {
+	var cmd Cmd
+	switch v := v.(type) {
+	case string:
+		return Cmd{Cmd: v}, nil
+	case map[interface{}]interface{}, map[string]interface{}:
+		dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			Result:           &cmd,
+			WeaklyTypedInput: true,
+			ErrorUnused:      true,
+			DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		})
+		if err != nil {
+			return cmd, err
+		}
+		if err := dec.Decode(v); err != nil {
+			return cmd, fmt.Errorf("invalid command %v: %v", v, err)
+		}
+	default:
+		return cmd, fmt.Errorf("expected string or mapping, got %T", v)
+	}
+	if cmd.Cmd == "" {
+		return cmd, fmt.Errorf("invalid command %v: missing cmd", v)
+	}
+	if _, err := regexp.Compile(cmd.Expect); err != nil {
+		return cmd, fmt.Errorf("invalid expect for %q: %v", cmd.Cmd, err)
+	}
+	return cmd, nil
+}
+
+// stringToKeyHookFunc decodes a key written as a plain path into a Key.
+func stringToKeyHookFunc(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(Key{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"key": data}, nil
+}
+
 // unmarshal reads in a src string and decodes the data.
 func unmarshal(v *viper.Viper, src string) (data interface{}, err error) {
 	if src == "" {
@@ -145,52 +255,28 @@ func (c *Config) String() string {
 	return c.text
 }
 
-// MapCmds prints a map from options to commands.
-func MapCmds(cfg *Config) (map[string][]string, error) {
-	cmds := make(map[string][]string, len(cfg.Config))
-	for _, set := range cfg.Config {
-		switch v := set.Cmds.(type) {
-		case []interface{}:
-			for i := 0; i < len(v); i++ {
-				if err := mapCmd(set, v[i], cmds); err != nil {
-					return nil, err
-				}
+// toCmds converts a sequence or index map of commands into Cmds.
+func toCmds(v interface{}) ([]Cmd, error) {
+	var cmds []Cmd
+	switch v := v.(type) {
+	case []interface{}:
+		for i := 0; i < len(v); i++ {
+			cmd, err := toCmd(v[i])
+			if err != nil {
+				return nil, err
 			}
-		case map[interface{}]interface{}:
-			for i := 0; i < len(v); i++ {
-				if err := mapCmd(set, v[i], cmds); err != nil {
-					return nil, err
-				}
+			cmds = append(cmds, cmd)
+		}
+	case map[interface{}]interface{}:
+		for i := 0; i < len(v); i++ {
+			cmd, err := toCmd(v[i])
+			if err != nil {
+				return nil, err
 			}
-		default:
-			return nil, fmt.Errorf("expected sequence or map, got %T", v)
+			cmds = append(cmds, cmd)
 		}
+	default:
+		return nil, fmt.Errorf("expected sequence or map, got %T", v)
 	}
 	return cmds, nil
 }
-
-// mapCmd maps a command to its options.
-func mapCmd(set cmdSet, v interface{}, cmds map[string][]string) error {
-	var keys []string
-	s := "IP Addr: %s, Hostname: %q, Vendor: %q, OS: %q, Model: %q, Version: %q"
-	if len(set.Models) > 0 {
-		for _, model := range set.Models {
-			keys = append(keys, fmt.Sprintf(s, set.Addr, set.Hostname, set.Vendor, set.OS, model, set.Version))
-		}
-	} else {
-		keys = append(keys, fmt.Sprintf(s, set.Addr, set.Hostname, set.Vendor, set.OS, "", set.Version))
-	}
-	cmd, ok := v.(string)
-	if !ok {
-		return fmt.Errorf("expected string, got %T", v)
-	}
-	for _, k := range keys {
-		if k == "" || k == fmt.Sprintf(s, "", "", "", "", "", "") {
-			k = "generic"
-		} else {
-			k = strings.TrimSpace(k)
-		}
-		cmds[k] = append(cmds[k], cmd)
-	}
-	return nil
-}
@@ -1,7 +1,6 @@
 package config
 
 import (
-	"fmt"
 	"testing"
 	"time"
 )
@@ -16,12 +15,37 @@ const (
 	options = `
 ---
 hosts: hosts.txt
+inventory: ansible
 user: user
 pass: password
+enable_secret: secret
 keys:
   - /home/user/.ssh/id_rsa
+  - key: /home/user/.ssh/id_ed25519
+    cert: /home/user/.ssh/id_ed25519-cert.pub
+agent: true
 accept: all
+known_hosts: /home/user/.ssh/known_hosts
 timeout: 10s
+errors:
+  - "^Error:"
+  - failed
+stop_on_error: true
+backup: backups
+restore: true
+`
+	jump = `
+---
+jump:
+  - host: bastion1.example.com
+    user: jumpuser
+    keys:
+      - /home/user/.ssh/jump_rsa
+    accept: known_hosts
+  - host: 10.0.0.1
+    port: 2222
+    pass: password
+    accept: tofu
 `
 	aliases = `
 ---
@@ -187,12 +211,47 @@ var configParseTests = []configTest{
 		src:  options,
 		ok:   noError,
 		want: &Config{
-			Hosts:   "hosts.txt",
-			User:    "user",
-			Pass:    "password",
-			Keys:    []string{"/home/user/.ssh/id_rsa"},
-			Accept:  "all",
-			Timeout: 10 * time.Second,
+			Hosts:        "hosts.txt",
+			Inventory:    "ansible",
+			User:         "user",
+			Pass:         "password",
+			EnableSecret: "secret",
+			Keys: []Key{
+				{Path: "/home/user/.ssh/id_rsa"},
+				{Path: "/home/user/.ssh/id_ed25519", Cert: "/home/user/.ssh/id_ed25519-cert.pub"},
+			},
+			Agent:       true,
+			Accept:      "all",
+			KnownHosts:  "/home/user/.ssh/known_hosts",
+			Timeout:     10 * time.Second,
+			Errors:      []string{"^Error:", "failed"},
+			StopOnError: true,
+			Backup:      "backups",
+			Restore:     true,
+		},
+	},
+	{
+		name: "match all",
+		data: "",
+		src:  "---\nmatch_all: true\n",
+		ok:   noError,
+		want: &Config{MatchAll: true},
+	},
+	{
+		name: "jump",
+		data: "",
+		src:  jump,
+		ok:   noError,
+		want: &Config{
+			Jump: []JumpHost{
+				{
+					Host:   "bastion1.example.com",
+					User:   "jumpuser",
+					Keys:   []Key{{Path: "/home/user/.ssh/jump_rsa"}},
+					Accept: "known_hosts",
+				},
+				{Host: "10.0.0.1", Port: 2222, Pass: "password", Accept: "tofu"},
+			},
 		},
 	},
 	{
@@ -351,29 +410,31 @@ func TestConfig_Parse(t *testing.T) {
 	}
 }
 
-func TestMapCmds(t *testing.T) {
-	cfg, err := New("cfg").Parse(aliases)
-	if err != nil {
-		t.Fatal(err)
-	}
-	cmds, err := MapCmds(cfg)
-	if err != nil {
-		t.Error(err)
-	}
-	s := "IP Addr: %s, Hostname: %q, Vendor: %q, OS: %q, Model: %q, Version: %q"
-	ciscoDefaultCmds, ok := cmds[fmt.Sprintf(s, "", "", "cisco", "", "", "")]
-	if !ok {
-		t.Errorf("key not in cmdMap")
-	}
-	if !slicesEqual(ciscoDefaultCmds, []string{"show lldp neighbors", "quit"}) {
-		t.Errorf("commands do not match")
+func TestToCmd(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want Cmd
+		ok   bool
+	}{
+		{"show clock", Cmd{Cmd: "show clock"}, noError},
+		{map[interface{}]interface{}{"cmd": "reload", "expect": `\[confirm\]`, "answer": "y"}, Cmd{Cmd: "reload", Expect: `\[confirm\]`, Answer: "y"}, noError},
+		{map[string]interface{}{"cmd": "write mem", "timeout": "2m"}, Cmd{Cmd: "write mem", Timeout: 2 * time.Minute}, noError},
+		{map[interface{}]interface{}{"cmd": "write mem", "timeout": "2 minutes"}, Cmd{}, hasError},
+		{map[interface{}]interface{}{"cmd": "reload", "expect": "[confirm"}, Cmd{}, hasError},
+		{map[interface{}]interface{}{"cmd": "reload", "answr": "y"}, Cmd{}, hasError},
+		{map[interface{}]interface{}{"expect": "confirm"}, Cmd{}, hasError},
+		{42, Cmd{}, hasError},
 	}
-	ciscoModifiedCmds, ok := cmds[fmt.Sprintf(s, "", "", "cisco", "", "c2960s", "")]
-	if !ok {
-		t.Errorf("key not in cmdMap")
-	}
-	if !slicesEqual(ciscoModifiedCmds, []string{"show lldp neighbors", "write mem", "quit"}) {
-		t.Errorf("commands do not match")
+	for _, test := range tests {
+		got, err := toCmd(test.v)
+		switch {
+		case err != nil && test.ok:
+			t.Errorf("%v: unexpected error: %v", test.v, err)
+		case err == nil && !test.ok:
+			t.Errorf("%v: expected error", test.v)
+		case test.ok && got != test.want:
+			t.Errorf("%v: want %+v, got %+v", test.v, test.want, got)
+		}
 	}
 }
 
@@ -391,11 +452,40 @@ func configsEqual(x, y *Config) bool {
 
 func optionsEqual(x, y *Config) bool {
 	return x.Hosts == y.Hosts &&
+		x.Inventory == y.Inventory &&
 		x.User == y.User &&
 		x.Pass == y.Pass &&
-		slicesEqual(x.Keys, y.Keys) &&
+		x.EnableSecret == y.EnableSecret &&
+		keysEqual(x.Keys, y.Keys) &&
+		x.Agent == y.Agent &&
 		x.Accept == y.Accept &&
-		x.Timeout == y.Timeout
+		x.KnownHosts == y.KnownHosts &&
+		x.Timeout == y.Timeout &&
+		slicesEqual(x.Errors, y.Errors) &&
+		x.StopOnError == y.StopOnError &&
+		x.Backup == y.Backup &&
+		x.Restore == y.Restore &&
+		x.MatchAll == y.MatchAll &&
+		jumpsEqual(x.Jump, y.Jump)
+}
+
+func jumpsEqual(x, y []JumpHost) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i].Host != y[i].Host ||
+			x[i].Port != y[i].Port ||
+			x[i].User != y[i].User ||
+			x[i].Pass != y[i].Pass ||
+			!keysEqual(x[i].Keys, y[i].Keys) ||
+			x[i].Agent != y[i].Agent ||
+			x[i].Accept != y[i].Accept ||
+			x[i].KnownHosts != y[i].KnownHosts {
+			return false
+		}
+	}
+	return true
 }
 
 func cmdSetsEqual(x, y []cmdSet) bool {
@@ -419,6 +509,18 @@ func cmdSetsEqual(x, y []cmdSet) bool {
 	return true
 }
 
+func keysEqual(x, y []Key) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func slicesEqual(x, y []string) bool {
 	if len(x) != len(y) {
 		return false
@@ -431,6 +533,13 @@ func slicesEqual(x, y []string) bool {
 	return true
 }
 
+func cmdStrings(cmds []Cmd) (s []string) {
+	for _, cmd := range cmds {
+		s = append(s, cmd.Cmd)
+	}
+	return s
+}
+
 func toStringSlice(x interface{}) (s []string) {
 	switch v := x.(type) {
 	case []interface{}:
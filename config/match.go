@@ -0,0 +1,281 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Facts are what is known about a host when choosing the command sets that
+// apply to it.
+type Facts struct {
+	Addr     string            // IP address of the host
+	Hostname string            // hostname of the host
+	Vendor   string            // vendor of the host
+	OS       string            // operating system of the host
+	Model    string            // model of the host
+	Version  string            // software version of the host
+	Groups   []string          // inventory groups of the host
+	Vars     map[string]string // inventory variables of the host
+}
+
+// Filter chooses the hosts that a command set applies to. Empty fields match
+// any host, and values are compared case-insensitively.
+type Filter struct {
+	Addr     string            // IP address of the host
+	Hostname string            // hostname of the host
+	Vendor   string            // vendor of the host
+	OS       string            // operating system of the host
+	Models   []string          // models, any of which the host is
+	Version  string            // software version of the host
+	Groups   []string          // inventory groups, any of which the host is in
+	Vars     map[string]string // inventory variables, all of which the host has
+}
+
+// Matches reports whether a filter matches a host.
+func (f Filter) Matches(facts Facts) bool {
+	if f.Addr != "" && !sameAddr(f.Addr, facts.Addr) {
+		return false
+	}
+	for _, field := range [][2]string{
+		{f.Hostname, facts.Hostname},
+		{f.Vendor, facts.Vendor},
+		{f.OS, facts.OS},
+		{f.Version, facts.Version},
+	} {
+		if field[0] != "" && !strings.EqualFold(field[0], field[1]) {
+			return false
+		}
+	}
+	if len(f.Models) > 0 && !containsFold(f.Models, facts.Model) {
+		return false
+	}
+	if len(f.Groups) > 0 && !anyFold(f.Groups, facts.Groups) {
+		return false
+	}
+	for k, v := range f.Vars {
+		if !hasVar(facts.Vars, k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Specificity ranks how specific a filter is. A filter on the address or
+// hostname is more specific than one on the model, the model than the
+// version, the version than the OS, the OS than the vendor, and the vendor
+// than inventory groups and variables.
+func (f Filter) Specificity() int {
+	ranks := []bool{
+		len(f.Groups) > 0 || len(f.Vars) > 0,
+		f.Vendor != "",
+		f.OS != "",
+		f.Version != "",
+		len(f.Models) > 0,
+		f.Addr != "" || f.Hostname != "",
+	}
+	n := 0
+	for i, set := range ranks {
+		if set {
+			n |= 1 << uint(i)
+		}
+	}
+	return n
+}
+
+// String returns the options of a filter, or "generic" if it matches any
+// host.
+func (f Filter) String() string {
+	var opts []string
+	add := func(name, value string) {
+		if value != "" {
+			opts = append(opts, fmt.Sprintf("%s: %s", name, value))
+		}
+	}
+	add("addr", f.Addr)
+	add("hostname", f.Hostname)
+	add("vendor", f.Vendor)
+	add("os", f.OS)
+	add("models", strings.Join(f.Models, " "))
+	add("version", f.Version)
+	add("groups", strings.Join(f.Groups, " "))
+	vars := make([]string, 0, len(f.Vars))
+	for k, v := range f.Vars {
+		vars = append(vars, k+"="+v)
+	}
+	sort.Strings(vars)
+	add("vars", strings.Join(vars, " "))
+	if len(opts) == 0 {
+		return "generic"
+	}
+	return strings.Join(opts, ", ")
+}
+
+// sameAddr reports whether two addresses are the same IP address, or are the
+// same ignoring case if either is not an IP address.
+func sameAddr(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return strings.EqualFold(a, b)
+	}
+	return ipA.Equal(ipB)
+}
+
+// sameFilter reports whether two filters are the same.
+func sameFilter(a, b Filter) bool {
+	if !sameAddr(a.Addr, b.Addr) {
+		return false
+	}
+	a.Addr, b.Addr = "", ""
+	return reflect.DeepEqual(a, b)
+}
+
+// containsFold reports whether any of the values equals s, ignoring case.
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyFold reports whether any of the values is in values2, ignoring case.
+func anyFold(values, values2 []string) bool {
+	for _, v := range values {
+		if containsFold(values2, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasVar reports whether vars has a variable, ignoring case.
+func hasVar(vars map[string]string, key, value string) bool {
+	for k, v := range vars {
+		if strings.EqualFold(k, key) && strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandSet is a set of commands and the hosts they apply to.
+type CommandSet struct {
+	Filter          // hosts the commands apply to
+	Priority int    // command sets with a higher priority are chosen over more specific ones
+	Mode     string // mode to run the commands in, "config" for configuration mode
+	Confirm  int    // minutes until a commit is rolled back unless confirmed
+	Check    []Cmd  // commands that must not fail to confirm a commit
+	Cmds     []Cmd  // configuration commands to run
+}
+
+// Matcher chooses the command sets of a config that apply to a host.
+type Matcher struct {
+	Sets []CommandSet // command sets in config order
+	All  bool         // choose every command set that applies, not just one
+}
+
+// NewMatcher creates a Matcher for the command sets of a config. Command sets
+// with the same filter are combined into one, in config order, and must have
+// the same mode, confirm and check.
+func NewMatcher(cfg *Config) (*Matcher, error) {
+	m := &Matcher{All: cfg.MatchAll}
+	for i, set := range cfg.Config {
+		cs, err := commandSet(set)
+		if err != nil {
+			return nil, fmt.Errorf("config %d: %v", i+1, err)
+		}
+		if err := m.add(cs); err != nil {
+			return nil, fmt.Errorf("config %d: %v", i+1, err)
+		}
+	}
+	return m, nil
+}
+
+// add adds a command set to a Matcher, combining it with any command set that
+// has the same filter. Command sets with the same filter must run in the same
+// mode, with the same confirm and check.
+func (m *Matcher) add(cs CommandSet) error {
+	for i := range m.Sets {
+		s := &m.Sets[i]
+		if !sameFilter(s.Filter, cs.Filter) {
+			continue
+		}
+		if s.Mode != cs.Mode || s.Confirm != cs.Confirm || !reflect.DeepEqual(s.Check, cs.Check) {
+			return fmt.Errorf("mode, confirm or check differs from the command set for the same hosts (%s)", s.Filter)
+		}
+		s.Cmds = append(s.Cmds, cs.Cmds...)
+		if cs.Priority > s.Priority {
+			s.Priority = cs.Priority
+		}
+		return nil
+	}
+	m.Sets = append(m.Sets, cs)
+	return nil
+}
+
+// Match returns the command sets that apply to a host. Unless All is set,
+// only the command set with the highest priority is returned, then the most
+// specific one, then the first one. With All, every command set that applies
+// is returned in config order.
+func (m *Matcher) Match(facts Facts) []CommandSet {
+	var sets []CommandSet
+	for _, s := range m.Sets {
+		if s.Matches(facts) {
+			sets = append(sets, s)
+		}
+	}
+	if m.All || len(sets) == 0 {
+		return sets
+	}
+	sort.SliceStable(sets, func(i, j int) bool {
+		if sets[i].Priority != sets[j].Priority {
+			return sets[i].Priority > sets[j].Priority
+		}
+		return sets[i].Specificity() > sets[j].Specificity()
+	})
+	return sets[:1]
+}
+
+// commandSet converts a command set of a config into a CommandSet.
+func commandSet(set cmdSet) (CommandSet, error) {
+	cs := CommandSet{
+		Filter: Filter{
+			Addr:     set.Addr,
+			Hostname: set.Hostname,
+			Vendor:   set.Vendor,
+			OS:       set.OS,
+			Models:   set.Models,
+			Version:  set.Version,
+			Groups:   set.Groups,
+			Vars:     set.Vars,
+		},
+		Priority: set.Priority,
+		Mode:     set.Mode,
+		Confirm:  set.Confirm,
+	}
+	switch set.Mode {
+	case "":
+		if set.Confirm != 0 || set.Check != nil {
+			return cs, errors.New("confirm and check require mode: config")
+		}
+	case "config":
+	default:
+		return cs, fmt.Errorf("expected mode config, got %q", set.Mode)
+	}
+
+	var err error
+	if cs.Cmds, err = toCmds(set.Cmds); err != nil {
+		return cs, err
+	}
+	if set.Check != nil {
+		if cs.Check, err = toCmds(set.Check); err != nil {
+			return cs, fmt.Errorf("check: %v", err)
+		}
+	}
+	return cs, nil
+}
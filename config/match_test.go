@@ -0,0 +1,383 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewMatcher(t *testing.T) {
+	cfg, err := New("cfg").Parse(aliases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMatcher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Sets) != 2 {
+		t.Fatalf("want 2 command sets, got %d", len(m.Sets))
+	}
+	if s := m.Sets[0]; s.Vendor != "cisco" || len(s.Models) != 0 || !slicesEqual(cmdStrings(s.Cmds), []string{"show lldp neighbors", "quit"}) {
+		t.Errorf("unexpected default command set: %+v", s)
+	}
+	if s := m.Sets[1]; !slicesEqual(s.Models, []string{"c2960s"}) || !slicesEqual(cmdStrings(s.Cmds), []string{"show lldp neighbors", "write mem", "quit"}) {
+		t.Errorf("unexpected c2960s command set: %+v", s)
+	}
+}
+
+func TestNewMatcher_Combine(t *testing.T) {
+	cfg, err := New("cfg").Parse(`
+config:
+  - vendor: cisco
+    cmds:
+      - show version
+  - vendor: hp
+    priority: -1
+    cmds:
+      - display version
+  - vendor: cisco
+    priority: 10
+    cmds:
+      - show clock
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMatcher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		vendor   string
+		priority int
+		cmds     []string
+	}{
+		{"cisco", 10, []string{"show version", "show clock"}},
+		{"hp", -1, []string{"display version"}},
+	}
+	if len(m.Sets) != len(tests) {
+		t.Fatalf("want %d command sets, got %d", len(tests), len(m.Sets))
+	}
+	for i, test := range tests {
+		s := m.Sets[i]
+		if s.Vendor != test.vendor || s.Priority != test.priority || !slicesEqual(cmdStrings(s.Cmds), test.cmds) {
+			t.Errorf("want %s with priority %d and %q, got %+v", test.vendor, test.priority, test.cmds, s)
+		}
+	}
+}
+
+func TestNewMatcher_Conflict(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		sets int
+		ok   bool
+	}{
+		{
+			name: "same addr",
+			src: `
+config:
+  - addr: 2001:db8::1
+    cmds:
+      - show version
+  - addr: 2001:DB8:0::1
+    cmds:
+      - show clock
+`,
+			sets: 1,
+			ok:   noError,
+		},
+		{
+			name: "same mode",
+			src: `
+config:
+  - vendor: cisco
+    os: ios xr
+    mode: config
+    confirm: 5
+    check:
+      - show bgp summary
+    cmds:
+      - hostname core-1
+  - vendor: cisco
+    os: ios xr
+    mode: config
+    confirm: 5
+    check:
+      - show bgp summary
+    cmds:
+      - ntp server 192.0.2.1
+`,
+			sets: 1,
+			ok:   noError,
+		},
+		{
+			name: "different mode",
+			src: `
+config:
+  - vendor: cisco
+    mode: config
+    cmds:
+      - hostname core-1
+  - vendor: cisco
+    cmds:
+      - show running-config
+`,
+			ok: hasError,
+		},
+		{
+			name: "different confirm",
+			src: `
+config:
+  - vendor: cisco
+    os: ios xr
+    mode: config
+    confirm: 5
+    cmds:
+      - hostname core-1
+  - vendor: cisco
+    os: ios xr
+    mode: config
+    cmds:
+      - ntp server 192.0.2.1
+`,
+			ok: hasError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := New("cfg").Parse(test.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := NewMatcher(cfg)
+			switch {
+			case err != nil && test.ok:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !test.ok:
+				t.Fatal("expected error, got none")
+			case err != nil && !test.ok:
+				t.Logf("got expected error: %v", err)
+				return
+			}
+			if len(m.Sets) != test.sets {
+				t.Errorf("want %d command sets, got %d", test.sets, len(m.Sets))
+			}
+		})
+	}
+}
+
+func TestNewMatcher_Rich(t *testing.T) {
+	cfg, err := New("cfg").Parse(`
+---
+config:
+  - vendor: cisco
+    cmds:
+      - show version
+      - cmd: copy run start
+        expect: Destination filename
+        answer: ""
+        timeout: 60s
+      - cmd: no vlan 999
+        ignore_errors: true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMatcher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.Sets[0].Cmds
+	want := []Cmd{
+		{Cmd: "show version"},
+		{Cmd: "copy run start", Expect: "Destination filename", Timeout: 60 * time.Second},
+		{Cmd: "no vlan 999", IgnoreErrors: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want %d commands, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("want %+v, got %+v", want[i], got[i])
+		}
+	}
+}
+
+func TestNewMatcher_Mode(t *testing.T) {
+	tests := []struct {
+		src  string
+		want CommandSet
+		ok   bool
+	}{
+		{
+			src: `
+config:
+  - vendor: cisco
+    os: ios xr
+    mode: config
+    confirm: 5
+    check:
+      - show bgp summary
+    cmds:
+      - hostname core-1
+`,
+			want: CommandSet{
+				Mode:    "config",
+				Confirm: 5,
+				Check:   []Cmd{{Cmd: "show bgp summary"}},
+				Cmds:    []Cmd{{Cmd: "hostname core-1"}},
+			},
+			ok: noError,
+		},
+		{
+			src: `
+config:
+  - vendor: cisco
+    os: ios xr
+    mode: exec
+    cmds:
+      - show version
+`,
+			ok: hasError,
+		},
+		{
+			src: `
+config:
+  - vendor: cisco
+    os: ios xr
+    confirm: 5
+    cmds:
+      - hostname core-1
+`,
+			ok: hasError,
+		},
+	}
+	for _, test := range tests {
+		cfg, err := New("cfg").Parse(test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := NewMatcher(cfg)
+		switch {
+		case err != nil && test.ok:
+			t.Errorf("unexpected error: %v", err)
+		case err == nil && !test.ok:
+			t.Errorf("expected error for:%s", test.src)
+		case test.ok:
+			got := m.Sets[0]
+			if got.Mode != test.want.Mode || got.Confirm != test.want.Confirm ||
+				!slicesEqual(cmdStrings(got.Check), cmdStrings(test.want.Check)) ||
+				!slicesEqual(cmdStrings(got.Cmds), cmdStrings(test.want.Cmds)) {
+				t.Errorf("want %+v, got %+v", test.want, got)
+			}
+		}
+	}
+}
+
+func TestFilter_Matches(t *testing.T) {
+	facts := Facts{
+		Addr:     "2001:db8::1",
+		Hostname: "core-1.example.com",
+		Vendor:   "CISCO",
+		OS:       "IOS",
+		Model:    "WS-C3750X-48P",
+		Version:  "C3750E-UNIVERSALK9-M Version 15.0(2)SE11, RELEASE SOFTWARE (fc3)",
+		Groups:   []string{"Core", "dc1"},
+		Vars:     map[string]string{"Role": "Core", "site": "dc1"},
+	}
+	tests := []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{}, true},
+		{Filter{Addr: "2001:DB8::1"}, true},
+		{Filter{Addr: "2001:DB8:0::1"}, true},
+		{Filter{Addr: "2001:db8::2"}, false},
+		{Filter{Vendor: "cisco", OS: "ios"}, true},
+		{Filter{Vendor: "cisco", OS: "ios xr"}, false},
+		{Filter{Models: []string{"c2960s", "ws-c3750x-48p"}}, true},
+		{Filter{Models: []string{"c2960s"}}, false},
+		{Filter{Version: "c3750e-universalk9-m Version 15.0(2)SE11, RELEASE SOFTWARE (fc3)"}, true},
+		{Filter{Groups: []string{"core"}}, true},
+		{Filter{Groups: []string{"access", "DC1"}}, true},
+		{Filter{Groups: []string{"access"}}, false},
+		{Filter{Vars: map[string]string{"role": "core"}}, true},
+		{Filter{Vars: map[string]string{"role": "core", "site": "dc1"}}, true},
+		{Filter{Vars: map[string]string{"role": "access"}}, false},
+		{Filter{Vars: map[string]string{"rack": "1"}}, false},
+	}
+	for _, test := range tests {
+		if got := test.filter.Matches(facts); got != test.want {
+			t.Errorf("%s: want %t, got %t", test.filter, test.want, got)
+		}
+	}
+}
+
+func TestFilter_Specificity(t *testing.T) {
+	// each filter is more specific than all of the filters after it combined
+	ordered := []Filter{
+		{Hostname: "switch-1"},
+		{Models: []string{"ws-c3750x-48p"}},
+		{Version: "15.0(2)SE11"},
+		{OS: "ios"},
+		{Vendor: "cisco"},
+		{Groups: []string{"core"}},
+		{},
+	}
+	for i := 1; i < len(ordered); i++ {
+		less := Filter{}
+		for _, f := range ordered[i:] {
+			less.Models = append(less.Models, f.Models...)
+			less.Groups = append(less.Groups, f.Groups...)
+			less.Version += f.Version
+			less.OS += f.OS
+			less.Vendor += f.Vendor
+		}
+		if more := ordered[i-1]; more.Specificity() <= less.Specificity() {
+			t.Errorf("want %s more specific than %s", more, less)
+		}
+	}
+	if (Filter{Addr: "10.0.0.1"}).Specificity() != (Filter{Hostname: "switch-1"}).Specificity() {
+		t.Error("want address and hostname equally specific")
+	}
+}
+
+func TestMatcher_Match(t *testing.T) {
+	m := &Matcher{Sets: []CommandSet{
+		{Filter: Filter{}, Cmds: []Cmd{{Cmd: "generic"}}},
+		{Filter: Filter{Vendor: "cisco"}, Cmds: []Cmd{{Cmd: "cisco"}}},
+		{Filter: Filter{Vendor: "cisco", Models: []string{"c3650"}}, Cmds: []Cmd{{Cmd: "c3650"}}},
+		{Filter: Filter{Addr: "2001:db8::1"}, Cmds: []Cmd{{Cmd: "addr"}}},
+		{Filter: Filter{Vendor: "hp"}, Priority: 1, Cmds: []Cmd{{Cmd: "hp"}}},
+		{Filter: Filter{Groups: []string{"lab"}}, Priority: 1, Cmds: []Cmd{{Cmd: "lab"}}},
+	}}
+	tests := []struct {
+		facts Facts
+		all   bool
+		want  []string
+	}{
+		{Facts{Vendor: "CISCO", Model: "C3650"}, false, []string{"c3650"}},
+		{Facts{Vendor: "CISCO", Model: "C2960S"}, false, []string{"cisco"}},
+		{Facts{Addr: "2001:db8::1", Vendor: "CISCO", Model: "C3650"}, false, []string{"addr"}},
+		{Facts{Vendor: "JUNIPER"}, false, []string{"generic"}},
+		{Facts{Vendor: "CISCO", Model: "C3650", Groups: []string{"lab"}}, false, []string{"lab"}},
+		{Facts{Vendor: "HP", Groups: []string{"lab"}}, false, []string{"hp"}},
+		{Facts{Vendor: "CISCO", Model: "C3650"}, true, []string{"generic", "cisco", "c3650"}},
+		{Facts{Vendor: "HP", Groups: []string{"lab"}}, true, []string{"generic", "hp", "lab"}},
+	}
+	for _, test := range tests {
+		m.All = test.all
+		var got []string
+		for _, s := range m.Match(test.facts) {
+			got = append(got, s.Cmds[0].Cmd)
+		}
+		if !slicesEqual(got, test.want) {
+			t.Errorf("%+v (all %t): want %q, got %q", test.facts, test.all, test.want, got)
+		}
+	}
+
+	if sets := (&Matcher{}).Match(Facts{Vendor: "CISCO"}); len(sets) != 0 {
+		t.Errorf("want no command sets, got %+v", sets)
+	}
+}
@@ -0,0 +1,246 @@
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// configHeader matches the lines at the start and end of a running
+// configuration that are not configuration commands, i.e. the XR timestamp.
+var configHeader = regexp.MustCompile(`^(?:Building configuration|Current configuration ?:|(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun) \w{3} +\d+ \d+:\d+:\d+|end$|return$|#$)`)
+
+// ConfigMode is how a commit of configuration changes is confirmed.
+type ConfigMode struct {
+	Confirm int       // minutes until a commit is rolled back unless confirmed
+	Check   []Command // commands that must not fail to confirm a commit
+}
+
+// Configure runs commands in configuration mode on the remote host and commits
+// the changes on platforms that need it. If a command fails, no more commands
+// are run and the changes are discarded, on platforms that commit changes, or
+// rolled back to a copy of the running configuration saved before them, on
+// platforms that can replace it.
+//
+// If mode.Confirm is set, the changes are committed with an automatic rollback
+// after mode.Confirm minutes, then the mode.Check commands are run and the
+// commit is confirmed if none of them fail. Platforms without commit confirmed
+// return an error without running any commands.
+func (c *Client) Configure(mode ConfigMode, cmds ...Command) ([]Output, error) {
+	s, err := c.session(true)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.driver.Configure == "" {
+		return nil, errors.New("configuration mode is not supported by the device")
+	}
+	confirm := mode.Confirm > 0
+	if confirm && s.driver.CommitConfirmed == "" && s.driver.CommitDelay == "" {
+		return nil, errors.New("confirm is not supported by the device, which cannot roll back a commit")
+	}
+	outs, err := s.checkpoint()
+	if err != nil {
+		return outs, err
+	}
+	start := []Command{{Cmd: s.driver.Configure}}
+	if confirm && s.driver.CommitDelay != "" {
+		start = append(start, Command{Cmd: fmt.Sprintf(s.driver.CommitDelay, mode.Confirm)})
+	}
+	more, err := s.runAll(append(start, cmds...), true)
+	outs = append(outs, more...)
+	if err != nil {
+		return s.rollback(outs, err)
+	}
+	if s.driver.Commit != "" {
+		commit := s.driver.Commit
+		if confirm && s.driver.CommitConfirmed != "" {
+			commit = fmt.Sprintf(s.driver.CommitConfirmed, mode.Confirm)
+		}
+		more, err := s.runAll([]Command{{Cmd: commit}}, true)
+		outs = append(outs, more...)
+		if err != nil {
+			return s.rollback(outs, fmt.Errorf("commit failed: %v", err))
+		}
+	}
+	if outs, err = s.end(outs); err != nil || !confirm {
+		return outs, err
+	}
+
+	more, err = s.runAll(mode.Check, true)
+	outs = append(outs, more...)
+	if err != nil {
+		return outs, fmt.Errorf("check failed, the commit will be rolled back in %d minutes: %v", mode.Confirm, err)
+	}
+	more, err = s.runAll([]Command{{Cmd: s.driver.Configure}, {Cmd: s.driver.Confirm}, {Cmd: s.driver.End}}, true)
+	outs = append(outs, more...)
+	if err != nil {
+		return outs, fmt.Errorf("could not confirm the commit, it will be rolled back in %d minutes: %v", mode.Confirm, err)
+	}
+	return outs, nil
+}
+
+// checkpoint saves the running configuration to roll back to on platforms
+// that roll back by replacing the running configuration.
+func (s *Session) checkpoint() ([]Output, error) {
+	if s.driver.Checkpoint.Cmd == "" {
+		return nil, nil
+	}
+	out := s.RunCommand(s.driver.Checkpoint)
+	if out.Err != nil {
+		return []Output{out}, fmt.Errorf("could not save the configuration to roll back to: %v", out.Err)
+	}
+	return []Output{out}, nil
+}
+
+// end leaves configuration mode.
+func (s *Session) end(outs []Output) ([]Output, error) {
+	out := s.RunCommand(Command{Cmd: s.driver.End})
+	outs = append(outs, out)
+	if out.Err != nil {
+		return outs, fmt.Errorf("could not leave configuration mode: %v", out.Err)
+	}
+	return outs, nil
+}
+
+// rollback leaves configuration mode after a command fails, discarding the
+// uncommitted changes or restoring the configuration saved by checkpoint on
+// platforms that support it.
+func (s *Session) rollback(outs []Output, err error) ([]Output, error) {
+	if s.closed || s.broken {
+		return outs, err
+	}
+	switch {
+	case s.driver.Abort != "":
+		out := s.RunCommand(Command{Cmd: s.driver.Abort})
+		outs = append(outs, out)
+		if out.Err != nil {
+			return outs, fmt.Errorf("%v, rollback failed: %v", err, out.Err)
+		}
+		return outs, fmt.Errorf("%v, uncommitted changes were discarded", err)
+	case s.driver.Rollback.Cmd != "":
+		// the command that failed may have entered a sub-view, so the
+		// rollback starts from the top of configuration mode
+		more, rerr := s.runAll([]Command{{Cmd: s.driver.End}, {Cmd: s.driver.Configure}, s.driver.Rollback, {Cmd: s.driver.End}}, true)
+		outs = append(outs, more...)
+		if rerr != nil {
+			return outs, fmt.Errorf("%v, rollback failed: %v", err, rerr)
+		}
+		return outs, fmt.Errorf("%v, changes were rolled back", err)
+	}
+	outs, _ = s.end(outs)
+	return outs, fmt.Errorf("%v, changes were not rolled back", err)
+}
+
+// RunningConfig returns the running configuration of the remote host.
+func (c *Client) RunningConfig() ([]byte, error) {
+	return c.showConfig(func(d Driver) string { return d.ShowConfig })
+}
+
+// StartupConfig returns the startup configuration of the remote host. Hosts
+// without a separate startup configuration, such as Cisco IOS XR devices,
+// return an empty configuration.
+func (c *Client) StartupConfig() ([]byte, error) {
+	if driverFor(c.vendor, c.os).ShowStartup == "" {
+		return nil, nil
+	}
+	return c.showConfig(func(d Driver) string { return d.ShowStartup })
+}
+
+// showConfig returns the output of the driver's command that shows a
+// configuration.
+func (c *Client) showConfig(show func(Driver) string) ([]byte, error) {
+	s, err := c.session(true)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := show(s.driver)
+	if cmd == "" {
+		return nil, errors.New("showing the configuration is not supported by the device")
+	}
+	out := s.RunCommand(Command{Cmd: cmd})
+	if out.Err != nil {
+		return nil, out.Err
+	}
+	return out.Out, nil
+}
+
+// Restore restores a running configuration saved by RunningConfig. On
+// platforms that support it, the running configuration is replaced, and
+// nothing is changed if any line of the saved configuration fails. On other
+// platforms, each line of the saved configuration is applied again, so changes
+// made since it was saved are undone but configuration added since is kept.
+func (c *Client) Restore(saved []byte) ([]Output, error) {
+	s, err := c.session(true)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.driver.Configure == "" {
+		return nil, errors.New("configuration mode is not supported by the device")
+	}
+	outs, err := s.checkpoint()
+	if err != nil {
+		return outs, err
+	}
+	replace := s.driver.Replace.Cmd != ""
+	cmds := []Command{{Cmd: s.driver.Configure}}
+	for _, line := range configLines(saved) {
+		cmds = append(cmds, Command{Cmd: line, IgnoreErrors: !replace})
+	}
+	more, err := s.runAll(cmds, true)
+	outs = append(outs, more...)
+	if err != nil {
+		return s.rollback(outs, err)
+	}
+
+	var commit []Command
+	switch {
+	case replace:
+		commit = append(commit, s.driver.Replace)
+	case s.driver.Commit != "":
+		commit = append(commit, Command{Cmd: s.driver.Commit})
+	}
+	more, err = s.runAll(commit, true)
+	outs = append(outs, more...)
+	if err != nil {
+		return s.rollback(outs, fmt.Errorf("commit failed: %v", err))
+	}
+	return s.end(outs)
+}
+
+// configLines returns the configuration commands of a saved running
+// configuration. Banners are skipped since their text is not followed by a
+// prompt.
+func configLines(cfg []byte) []string {
+	var lines []string
+	var delim string
+	sc := bufio.NewScanner(bytes.NewReader(cfg))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " \t")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case delim != "":
+			if strings.Contains(trimmed, delim) {
+				delim = ""
+			}
+			continue
+		case strings.HasPrefix(trimmed, "banner "):
+			// banner motd ^C, where the text ends at the next ^C
+			fields := strings.Fields(trimmed)
+			d := fields[len(fields)-1]
+			if len(fields) > 2 && strings.Count(trimmed, d[:1]) < 2 {
+				delim = d[:1]
+			}
+			continue
+		case trimmed == "" || configHeader.MatchString(trimmed):
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
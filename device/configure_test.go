@@ -0,0 +1,260 @@
+package device
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClient_Configure(t *testing.T) {
+	const prompt, configPrompt = "RP/0/RSP0/CPU0:core-1#", "RP/0/RSP0/CPU0:core-1(config)#"
+	responses := map[string]response{
+		"terminal length 0":            {},
+		"configure terminal":           {prompt: configPrompt},
+		"hostname core-1":              {prompt: configPrompt},
+		"commit confirmed minutes 5":   {prompt: configPrompt},
+		"commit":                       {prompt: configPrompt},
+		"abort":                        {},
+		"end":                          {},
+		"show bgp summary":             {out: "BGP router identifier 10.0.0.1\r\n"},
+		"exit":                         {exit: true},
+		"interface GigabitEthernet0/1": {out: "% Invalid input detected at '^' marker.\r\n", prompt: configPrompt},
+	}
+	tests := []struct {
+		name string
+		os   string
+		mode ConfigMode
+		cmds []string
+		want []string
+		err  string
+	}{
+		{
+			name: "commit",
+			os:   "IOS XR",
+			cmds: []string{"hostname core-1"},
+			want: []string{"configure terminal", "hostname core-1", "commit", "end"},
+		},
+		{
+			name: "commit confirmed",
+			os:   "IOS XR",
+			mode: ConfigMode{Confirm: 5, Check: []Command{{Cmd: "show bgp summary"}}},
+			cmds: []string{"hostname core-1"},
+			want: []string{"configure terminal", "hostname core-1", "commit confirmed minutes 5", "end", "show bgp summary", "configure terminal", "commit", "end"},
+		},
+		{
+			name: "check failed",
+			os:   "IOS XR",
+			mode: ConfigMode{Confirm: 5, Check: []Command{{Cmd: "show bgp neighbors"}}},
+			cmds: []string{"hostname core-1"},
+			want: []string{"configure terminal", "hostname core-1", "commit confirmed minutes 5", "end", "show bgp neighbors"},
+			err:  "rolled back in 5 minutes",
+		},
+		{
+			name: "abort",
+			os:   "IOS XR",
+			cmds: []string{"interface GigabitEthernet0/1", "hostname core-1"},
+			want: []string{"configure terminal", "interface GigabitEthernet0/1", "abort"},
+			err:  "uncommitted changes were discarded",
+		},
+		{
+			name: "no commit",
+			os:   "IOS",
+			cmds: []string{"hostname core-1"},
+			want: []string{"configure terminal", "hostname core-1", "end"},
+		},
+		{
+			name: "no rollback",
+			os:   "IOS",
+			cmds: []string{"interface GigabitEthernet0/1", "hostname core-1"},
+			want: []string{"configure terminal", "interface GigabitEthernet0/1", "end"},
+			err:  "not rolled back",
+		},
+		{
+			name: "no commit confirmed",
+			os:   "IOS",
+			mode: ConfigMode{Confirm: 5},
+			cmds: []string{"hostname core-1"},
+			want: []string{},
+			err:  "confirm is not supported",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := serveCLI(t, "CISCO", prompt, responses)
+			client.os = test.os
+			cmds := make([]Command, len(test.cmds))
+			for i, cmd := range test.cmds {
+				cmds[i] = Command{Cmd: cmd}
+			}
+			outs, err := client.Configure(test.mode, cmds...)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("want error containing %q, got %v", test.err, err)
+			}
+			got := make([]string, len(outs))
+			for i, out := range outs {
+				got[i] = out.Cmd
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("want commands %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestClient_Configure_Comware(t *testing.T) {
+	const prompt, configPrompt = "<core-1>", "[core-1]"
+	responses := map[string]response{
+		"screen-length disable":           {},
+		"save flash:/netcfg-rollback.cfg": {prompt: "The current configuration will be saved to flash:/netcfg-rollback.cfg. Continue? [Y/N]:"},
+		"y":                               {out: "Configuration is saved to device successfully.\r\n"},
+		"system-view":                     {prompt: configPrompt},
+		"configuration commit delay 5":    {prompt: configPrompt},
+		"sysname core-1":                  {prompt: configPrompt},
+		"interface Gi1/0/1":               {out: "% Unrecognized command found at '^' position.\r\n", prompt: configPrompt},
+		"configuration replace file flash:/netcfg-rollback.cfg": {prompt: "Current configuration will be lost, save current configuration? [Y/N]:"},
+		"n":                    {out: "Info: Succeeded in replacing current configuration.\r\n", prompt: configPrompt},
+		"configuration commit": {prompt: configPrompt},
+		"return":               {},
+		"display bgp peer":     {out: "BGP local router ID: 10.0.0.1\r\n"},
+		"quit":                 {exit: true},
+	}
+	const save, replace = "save flash:/netcfg-rollback.cfg", "configuration replace file flash:/netcfg-rollback.cfg"
+	tests := []struct {
+		name string
+		mode ConfigMode
+		cmds []string
+		want []string
+		err  string
+	}{
+		{
+			name: "changes",
+			cmds: []string{"sysname core-1"},
+			want: []string{save, "system-view", "sysname core-1", "return"},
+		},
+		{
+			name: "commit delay",
+			mode: ConfigMode{Confirm: 5, Check: []Command{{Cmd: "display bgp peer"}}},
+			cmds: []string{"sysname core-1"},
+			want: []string{save, "system-view", "configuration commit delay 5", "sysname core-1", "return", "display bgp peer", "system-view", "configuration commit", "return"},
+		},
+		{
+			name: "rollback",
+			cmds: []string{"interface Gi1/0/1", "sysname core-1"},
+			want: []string{save, "system-view", "interface Gi1/0/1", "return", "system-view", replace, "return"},
+			err:  "changes were rolled back",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := serveCLI(t, "HP", prompt, responses)
+			client.os = "Comware"
+			cmds := make([]Command, len(test.cmds))
+			for i, cmd := range test.cmds {
+				cmds[i] = Command{Cmd: cmd}
+			}
+			outs, err := client.Configure(test.mode, cmds...)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("want error containing %q, got %v", test.err, err)
+			}
+			got := make([]string, len(outs))
+			for i, out := range outs {
+				got[i] = out.Cmd
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("want commands %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestClient_Restore(t *testing.T) {
+	const prompt, configPrompt = "RP/0/RSP0/CPU0:core-1#", "RP/0/RSP0/CPU0:core-1(config)#"
+	const saved = "Mon Jan  1 12:00:00.000 UTC\n" +
+		"Building configuration...\n" +
+		"!! IOS XR Configuration 6.1.3\n" +
+		"hostname core-1\n" +
+		"interface GigabitEthernet0/0/0/1\n" +
+		" description uplink\n" +
+		"!\n" +
+		"end\n"
+	responses := map[string]response{
+		"terminal length 0":                {},
+		"show running-config":              {out: strings.Replace(saved, "\n", "\r\n", -1)},
+		"configure terminal":               {prompt: configPrompt},
+		"!! IOS XR Configuration 6.1.3":    {prompt: configPrompt},
+		"hostname core-1":                  {prompt: configPrompt},
+		"interface GigabitEthernet0/0/0/1": {prompt: configPrompt},
+		" description uplink":              {prompt: configPrompt},
+		"!":                                {prompt: configPrompt},
+		"commit replace":                   {out: "This commit will replace or remove the entire running configuration.\r\n", prompt: "Do you wish to proceed? [no]: "},
+		"yes":                              {prompt: configPrompt},
+		"commit":                           {prompt: configPrompt},
+		"abort":                            {},
+		"end":                              {},
+		"exit":                             {exit: true},
+	}
+	client := serveCLI(t, "CISCO", prompt, responses)
+	client.os = "IOS XR"
+
+	cfg, err := client.RunningConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cfg) != strings.TrimSpace(saved) {
+		t.Errorf("want running config %q, got %q", saved, cfg)
+	}
+
+	outs, err := client.Restore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"configure terminal", "!! IOS XR Configuration 6.1.3", "hostname core-1", "interface GigabitEthernet0/0/0/1", " description uplink", "!", "commit replace", "end"}
+	got := make([]string, len(outs))
+	for i, out := range outs {
+		got[i] = out.Cmd
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want commands %q, got %q", want, got)
+	}
+
+	// a line that fails aborts the replace
+	outs, err = client.Restore([]byte("hostname core-1\nbogus\n"))
+	if err == nil || !strings.Contains(err.Error(), "discarded") {
+		t.Errorf("want discarded error, got %v", err)
+	}
+	if len(outs) == 0 || outs[len(outs)-1].Cmd != "abort" {
+		t.Errorf("want abort after failed line, got %v", outs)
+	}
+
+	// other platforms ignore lines that fail
+	client.os = "IOS"
+	if _, err := client.Restore([]byte("hostname core-1\nbogus\n")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigLines(t *testing.T) {
+	const cfg = `Building configuration...
+
+Current configuration : 1234 bytes
+!
+version 15.0
+hostname switch-1
+banner motd ^C
+Authorized access only
+^C
+banner login ^CHello^C
+interface GigabitEthernet1/0/1
+ description uplink
+!
+end`
+	want := []string{"!", "version 15.0", "hostname switch-1", "interface GigabitEthernet1/0/1", " description uplink", "!"}
+	if got := configLines([]byte(cfg)); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
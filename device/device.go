@@ -1,54 +1,130 @@
 package device
 
 import (
-	"bytes"
 	"fmt"
 	"net"
 	"regexp"
-	"strings"
 	"time"
 
-	snmp "github.com/mwalto7/gosnmp"
-	"github.com/pkg/errors"
-	"github.com/spf13/viper"
 	"golang.org/x/crypto/ssh"
 )
 
-// Timeout is the duration to wait for an SSH connection to establish.
+// Timeout is the duration to wait for each command run on a remote device to
+// finish. If zero, DefaultCmdTimeout is used.
 var Timeout = time.Duration(0)
 
+// ErrorPatterns are regular expressions that match error messages in the
+// output of commands, in addition to the error messages of each vendor.
+var ErrorPatterns []*regexp.Regexp
+
+// StopOnError stops running the commands on a remote device after the first
+// command that fails.
+var StopOnError bool
+
 // Client represents an SSH client for a network device.
 type Client struct {
-	client   *ssh.Client // underlying SSH client connection
-	addr     string      // IP address of the device
-	hostname string      // hostname of the device
-	vendor   string      // vendor of the device
-	os       string      // operating system of the device
-	model    string      // model of the device
-	version  string      // software version of the device
+	client   *ssh.Client   // underlying SSH client connection
+	jumps    []*ssh.Client // SSH client connections to the jump hosts
+	addr     string        // IP address of the device
+	hostname string        // hostname of the device
+	vendor   string        // vendor of the device
+	os       string        // operating system of the device
+	model    string        // model of the device
+	version  string        // software version of the device
+	warnings []error       // problems discovering the device
+	shell    *Session      // session shared by the commands run on the device
 }
 
-// Dial establishes an SSH client connection to a remote host.
-func Dial(host, port string, clientCfg *ssh.ClientConfig) (*Client, error) {
-	client, err := ssh.Dial("tcp", net.JoinHostPort(host, port), clientCfg)
+// Jump is a jump host used to reach a device, like OpenSSH's ProxyJump.
+type Jump struct {
+	Addr   string            // address of the jump host as host:port
+	Config *ssh.ClientConfig // SSH client config for the jump host
+}
+
+// Dial establishes an SSH client connection to a remote host and discovers
+// the device with the SNMP settings of the global config. If any jump hosts
+// are given, the connection is tunneled through each of them in order.
+func Dial(host, port string, clientCfg *ssh.ClientConfig, jumps ...Jump) (*Client, error) {
+	settings, err := SNMPSettings()
 	if err != nil {
 		return nil, err
 	}
-	s := strings.Split(client.RemoteAddr().String(), ":")
-	addr := strings.Join(s[:len(s)-1], "")
-	m := sysDescr(addr)
-	c := &Client{
-		client:   client,
-		addr:     m["addr"],
-		hostname: m["hostname"],
-		vendor:   m["vendor"],
-		os:       m["os"],
-		model:    m["model"],
-		version:  m["version"],
+	return DialSNMP(host, port, clientCfg, settings, jumps...)
+}
+
+// DialSNMP is like Dial, but discovers the device with the given SNMP
+// settings. A device that cannot be discovered with SNMP is identified
+// through its SSH connection instead, and is left unidentified if that fails
+// too. Either way the discovery errors are kept as Warnings.
+func DialSNMP(host, port string, clientCfg *ssh.ClientConfig, settings SNMP, jumps ...Jump) (*Client, error) {
+	client, jumpClients, err := dial(net.JoinHostPort(host, port), clientCfg, jumps)
+	if err != nil {
+		return nil, err
 	}
+	c := &Client{client: client, jumps: jumpClients, addr: remoteAddr(host, client, len(jumps) > 0)}
+	c.discover(settings)
 	return c, nil
 }
 
+// dial connects to addr through a chain of jump hosts and returns the client
+// connection to addr and the client connections to the jump hosts.
+func dial(addr string, clientCfg *ssh.ClientConfig, jumps []Jump) (*ssh.Client, []*ssh.Client, error) {
+	if len(jumps) == 0 {
+		client, err := ssh.Dial("tcp", addr, clientCfg)
+		return client, nil, err
+	}
+
+	jumpClients := make([]*ssh.Client, 0, len(jumps))
+	closeAll := func() {
+		for i := len(jumpClients) - 1; i >= 0; i-- {
+			jumpClients[i].Close()
+		}
+	}
+	client, err := ssh.Dial("tcp", jumps[0].Addr, jumps[0].Config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("jump host %s: %v", jumps[0].Addr, err)
+	}
+	jumpClients = append(jumpClients, client)
+
+	hops := make([]Jump, 0, len(jumps))
+	hops = append(hops, jumps[1:]...)
+	hops = append(hops, Jump{Addr: addr, Config: clientCfg})
+	for i, hop := range hops {
+		conn, err := client.Dial("tcp", hop.Addr)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("could not tunnel to %s through %s: %v", hop.Addr, jumps[i].Addr, err)
+		}
+		c, chans, reqs, err := ssh.NewClientConn(conn, hop.Addr, hop.Config)
+		if err != nil {
+			conn.Close()
+			closeAll()
+			if i < len(hops)-1 {
+				return nil, nil, fmt.Errorf("jump host %s: %v", hop.Addr, err)
+			}
+			return nil, nil, err
+		}
+		client = ssh.NewClient(c, chans, reqs)
+		if i < len(hops)-1 {
+			jumpClients = append(jumpClients, client)
+		}
+	}
+	return client, jumpClients, nil
+}
+
+// remoteAddr returns the IP address of the device connected to as host. A
+// connection tunneled through jump hosts has the zero address as its remote
+// address, so host is used as is.
+func remoteAddr(host string, client *ssh.Client, tunneled bool) string {
+	if tunneled {
+		return host
+	}
+	if tcpAddr, ok := client.RemoteAddr().(*net.TCPAddr); ok && tcpAddr.IP != nil {
+		return tcpAddr.IP.String()
+	}
+	return host
+}
+
 // Addr returns the remote host's IP address.
 func (c *Client) Addr() string {
 	if c == nil {
@@ -97,60 +173,110 @@ func (c *Client) Version() string {
 	return c.version
 }
 
-// Run creates a new SSH session, starts a remote shell, and runs the
-// specified commands on the remote host.
-func (c *Client) Run(cmds ...string) ([]byte, error) {
-	// create a new session
-	session, err := c.client.NewSession()
-	if err != nil {
-		return nil, err
+// Run runs the specified commands one at a time in an interactive shell
+// session on the remote host, waiting for the device prompt after each
+// command, and returns the output of each command that was run. The session
+// is shared by everything run on the host: it enters privileged mode and
+// disables paging before the first commands, and it is logged out of when the
+// client is closed, as needed by the device's platform. If a command
+// prints an error message, the remaining commands are still run unless
+// StopOnError is set, and an error is returned.
+func (c *Client) Run(cmds ...string) ([]Output, error) {
+	commands := make([]Command, len(cmds))
+	for i, cmd := range cmds {
+		commands[i] = Command{Cmd: cmd}
 	}
-	defer session.Close()
+	return c.RunCommands(commands...)
+}
 
-	// create a pipe to the remote device's standard input
-	stdin, err := session.StdinPipe()
+// RunCommands is like Run, but runs commands with their own expected prompts,
+// timeouts and error handling. Error messages from commands with IgnoreErrors
+// set are reported in their output but do not fail the commands.
+func (c *Client) RunCommands(cmds ...Command) ([]Output, error) {
+	s, err := c.session(true)
 	if err != nil {
-		return nil, fmt.Errorf("could not create pipe to remote standard input: %v", err)
+		return nil, err
 	}
-	defer stdin.Close()
-
-	// copy the remote device's standard output to a buffer
-	var buf bytes.Buffer
-	session.Stdout = &buf
+	return s.runAll(cmds, StopOnError)
+}
 
-	// start the remote shell
-	if err := session.Shell(); err != nil {
-		return nil, fmt.Errorf("could not start remote shell: %v", err)
+// session returns the session shared by everything run on the remote host,
+// since many devices allow only one session per connection, or only a few in
+// a row. A new session is started if there is none yet or the last one was
+// closed or is stuck. If prepare is set, the session is prepared with open
+// the first time, for the device as identified by then.
+func (c *Client) session(prepare bool) (*Session, error) {
+	if c.shell != nil && (c.shell.closed || c.shell.broken) {
+		c.shell.Close()
+		c.shell = nil
 	}
-
-	// run the commands
-	for _, cmd := range cmds {
-		if _, err := stdin.Write([]byte(cmd + "\n")); err != nil {
-			return nil, fmt.Errorf("failed to run %q: %v", cmd, err)
+	if c.shell == nil {
+		s, err := c.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		c.shell = s
+	}
+	s := c.shell
+	if !prepare {
+		return s, nil
+	}
+	s.setPlatform(c.vendor, c.os)
+	if !s.opened {
+		if err := s.open(); err != nil {
+			c.shell = nil
+			s.Close()
+			return nil, err
 		}
+		s.opened = true
 	}
+	return s, nil
+}
 
-	// wait for the remote commands to exit or time out
-	wait := make(chan error)
-	go func() {
-		wait <- session.Wait()
-	}()
-	select {
-	case err := <-wait:
-		if err != nil {
-			switch v := err.(type) {
-			case *ssh.ExitError:
-				return nil, fmt.Errorf("session exited with status %d: %v", v.ExitStatus(), v)
-			case *ssh.ExitMissingError:
-				return nil, fmt.Errorf("session exited with no status: %v", v)
-			default:
-				return nil, fmt.Errorf("session failed to exit: %v", v)
+// runAll runs commands in a session and returns the output of each command
+// that was run. If stop is set, no commands are run after a command fails.
+func (s *Session) runAll(cmds []Command, stop bool) ([]Output, error) {
+	outs := make([]Output, 0, len(cmds))
+	failed := 0
+	for i, cmd := range cmds {
+		out := s.RunCommand(cmd)
+		if out.Err == ErrSessionClosed {
+			out.Err = nil
+			outs = append(outs, out)
+			if i < len(cmds)-1 {
+				return outs, fmt.Errorf("session closed after %q with %d commands not run", cmd.Cmd, len(cmds)-1-i)
+			}
+			break
+		}
+		outs = append(outs, out)
+		if _, ok := out.Err.(*CommandError); ok {
+			if cmd.IgnoreErrors {
+				continue
+			}
+			failed++
+			if stop && i < len(cmds)-1 {
+				return outs, fmt.Errorf("%q failed with %d commands not run: %v", cmd.Cmd, len(cmds)-1-i, out.Err)
 			}
+			continue
 		}
-		return buf.Bytes(), nil
-	case <-time.After(Timeout):
-		return nil, errors.New("session timed out")
+		if out.Err != nil {
+			return outs, out.Err
+		}
+	}
+	if failed > 0 {
+		return outs, fmt.Errorf("%d of %d commands failed", failed, len(cmds))
 	}
+	return outs, nil
+}
+
+// Warnings returns the problems discovering the remote host that did not
+// fail the connection, i.e. an SNMP error when the host was identified
+// through its SSH connection instead.
+func (c *Client) Warnings() []error {
+	if c == nil {
+		return nil
+	}
+	return c.warnings
 }
 
 // String is the string representation of a client.
@@ -162,122 +288,49 @@ func (c *Client) String() string {
 		c.addr, c.hostname, c.vendor, c.os, c.model, c.version)
 }
 
-// Close closes the SSH client connection to the remote host.
+// Close logs out of the session on the remote host, if any, and closes the
+// SSH client connection to the remote host and to any jump hosts used to
+// reach it.
 func (c *Client) Close() error {
-	return c.client.Close()
-}
-
-// sysDescr gets the sysDescr from an ssh client.
-func sysDescr(addr string) map[string]string {
-	info := make(chan map[string]string)
-	go getSysDescr(addr, info)
-
-	// lookup hostname
-	var hostname string
-	names, err := net.LookupAddr(addr)
-	if err == nil && len(names) > 0 {
-		hostname = names[0]
+	if c.shell != nil {
+		c.shell.logout()
+		c.shell.Close()
+		c.shell = nil
 	}
-	m := <-info
-	m["addr"] = addr
-	m["hostname"] = hostname
-	return m
-}
-
-// getSysDescr gets the sysDescr of a host through SNMP.
-func getSysDescr(addr string, info chan<- map[string]string) {
-	defer close(info)
-
-	client, err := snmp.NewClient(addr, viper.GetString("snmp.community"), snmp.Version2c, 5)
-	if err != nil {
-		info <- map[string]string{"addr": "", "hostname": "", "vendor": "", "os": "", "model": "", "version": ""}
-		return
-	}
-	defer client.Close()
-
-	res, err := client.Get(".1.3.6.1.2.1.1.1.0")
-	if err != nil {
-		info <- map[string]string{"addr": "", "hostname": "", "vendor": "", "os": "", "model": "", "version": ""}
-		return
-	}
-	var descr string
-	for _, v := range res.Variables {
-		if v.Type == snmp.OctetString {
-			descr = v.Value.(string)
-			break
-		}
+	err := c.client.Close()
+	for i := len(c.jumps) - 1; i >= 0; i-- {
+		c.jumps[i].Close()
 	}
-	info <- parseSysDescr(descr)
+	return err
 }
 
-const (
-	// Cisco IOS, IOS XE, IOS XR, and NX-OS regexp strings
-	ciscoModel    = `(([CATcat]{1,3}|[Nn]|[Mm]|[CGRcgr]{3})(\d{4}\w?|\d\w_\w*)|\w?\d*_rp)`
-	ciscoSoftware = ciscoModel + `(-(\w*[Kk]9|Y|I)([-_]([WANwan-]*)?[Mm][Zz]?)?)`
-	ciscoVersion  = `(Version (\(?(\d{1,2}|\w{1,2})\)?\.?)*)([[(].*[])])?(,?\s?)(RELEASE SOFTWARE (\(.*\)))?`
-
-	// HPE Comware and Procurve
-	hpeModel        = `(HP|HPE|ProCurve).*Switch\s?\w*,?`
-	comwareVersion  = `Software\sVersion\s(\d{1,3}\.?)*,?\s?Release\s\d{4}`
-	procurveVersion = `revision [A-Z]{1,2}(\.[0-9]{2,4})*,?\s?ROM [A-Z]{1,2}(\.[0-9]{2,4})*`
-)
-
-var (
-	// Cisco
-	modelCisco    = regexp.MustCompile(ciscoModel)
-	softwareCisco = regexp.MustCompile(ciscoSoftware)
-	versionCisco  = regexp.MustCompile(ciscoVersion)
-
-	// Hewlett Packard
-	modelHPE        = regexp.MustCompile(hpeModel)
-	versionComware  = regexp.MustCompile(comwareVersion)
-	versionProCurve = regexp.MustCompile(procurveVersion)
-)
-
-// parseSysDescr parses the sysDescr.0 OID string to gather device information.
-func parseSysDescr(sysDescr string) map[string]string {
-	m := map[string]string{
-		"addr":     "",
-		"hostname": "",
-		"vendor":   "",
-		"os":       "",
-		"model":    "",
-		"version":  "",
-	}
-	switch {
-	case strings.Contains(sysDescr, "Cisco"):
-		m["vendor"] = "CISCO"
-		m["model"] = modelCisco.FindString(sysDescr)
-		software := softwareCisco.FindString(sysDescr)
-		version := versionCisco.FindString(sysDescr)
-		v := strings.Replace(version, ",", "", 5)
-		m["version"] = strings.TrimSpace(fmt.Sprintf("%s %s", software, v))
-		switch {
-		case strings.Contains(sysDescr, "IOS"):
-			switch {
-			case strings.Contains(sysDescr, "IOS XR"), strings.Contains(sysDescr, "IOS-XR"):
-				m["os"] = "IOS XR"
-			case strings.Contains(sysDescr, "IOS XE"), strings.Contains(sysDescr, "IOS-XE"):
-				m["os"] = "IOS XE"
-			default:
-				m["os"] = "IOS"
-			}
-		case strings.Contains(sysDescr, "NX OS"), strings.Contains(sysDescr, "NX-OS"):
-			m["os"] = "NX-OS"
+// discover identifies the device through SNMP, or through its SSH
+// connection if it cannot be discovered with SNMP, and looks up its hostname.
+// A device that cannot be identified either way has no facts.
+func (c *Client) discover(settings SNMP) {
+	hostnames := make(chan string, 1)
+	go func() {
+		var hostname string
+		names, err := net.LookupAddr(c.addr)
+		if err == nil && len(names) > 0 {
+			hostname = names[0]
 		}
-	case strings.Contains(sysDescr, "Hewlett Packard"),
-		strings.Contains(sysDescr, "HP"),
-		strings.Contains(sysDescr, "ProCurve"):
-		m["vendor"] = "HP"
-		m["model"] = modelHPE.FindString(sysDescr)
-		switch {
-		case strings.Contains(sysDescr, "Comware"):
-			m["os"] = "Comware"
-			m["version"] = versionComware.FindString(sysDescr)
-		case strings.Contains(sysDescr, "ProCurve"):
-			m["os"] = "ProCurve"
-			m["version"] = versionProCurve.FindString(sysDescr)
+		hostnames <- hostname
+	}()
+
+	m, err := snmpFacts(c.addr, settings)
+	if err != nil {
+		var sshErr error
+		if m, sshErr = c.sshFacts(); sshErr != nil {
+			m = parseSysDescr("")
+			c.warnings = append(c.warnings, fmt.Errorf("could not identify the device: snmp discovery failed: %v; ssh discovery failed: %v", err, sshErr))
+		} else {
+			c.warnings = append(c.warnings, fmt.Errorf("snmp discovery failed, identified the device through ssh: %v", err))
 		}
 	}
-	return m
+	c.hostname = <-hostnames
+	c.vendor = m["vendor"]
+	c.os = m["os"]
+	c.model = m["model"]
+	c.version = m["version"]
 }
@@ -1,8 +1,17 @@
 package device
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"net"
+	"strconv"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 func TestClient_Addr(t *testing.T) {
@@ -84,38 +93,24 @@ func TestClient_String(t *testing.T) {
 	}
 	want := fmt.Sprintf("IP Addr: %s, Hostname: %s, Vendor: %s, OS: %s, Model: %s, Version: %s",
 		"127.0.0.1", "localhost", "cisco", "ios", "c2960s", "15.0(2)SE10a")
-	c = &Client{nil, "127.0.0.1", "localhost", "cisco", "ios", "c2960s", "15.0(2)SE10a"}
+	c = &Client{
+		addr:     "127.0.0.1",
+		hostname: "localhost",
+		vendor:   "cisco",
+		os:       "ios",
+		model:    "c2960s",
+		version:  "15.0(2)SE10a",
+	}
 	if c.String() != want {
 		t.Errorf("want %s, got %s", want, c.String())
 	}
 }
 
-func TestGetSysDescr(t *testing.T) {
-	want := map[string]string{
-		"addr":     "",
-		"hostname": "",
-		"vendor":   "",
-		"os":       "",
-		"model":    "",
-		"version":  "",
-	}
-	info := make(chan map[string]string)
-	go getSysDescr("127.0.0.1", info)
-	got, ok := <-info
-	if !ok {
-		t.Fatal("channel closed")
-	}
-	if len(got) != len(want) {
-		t.Fatal("maps not same length")
-	}
-	for k, v := range want {
-		val, ok := got[k]
-		if !ok {
-			t.Fatalf("key %s not in map", k)
-		}
-		if val != v {
-			t.Errorf("want %s, got %s", v, val)
-		}
+func TestSNMPFacts(t *testing.T) {
+	// no SNMP agent listens on the port
+	m, err := snmpFacts("127.0.0.1", SNMP{Community: "public", Timeout: 100 * time.Millisecond})
+	if err == nil {
+		t.Errorf("want error without an SNMP agent, got %v", m)
 	}
 }
 
@@ -263,3 +258,136 @@ func TestParseSysDescr(t *testing.T) {
 		})
 	}
 }
+
+// serveSSH starts a local SSH server that accepts the password "password"
+// and forwards direct-tcpip channels, then returns its address.
+func serveSSH(t *testing.T) string {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCfg := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) != "password" {
+				return nil, fmt.Errorf("wrong password")
+			}
+			return nil, nil
+		},
+	}
+	serverCfg.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sconn, chans, reqs, err := ssh.NewServerConn(conn, serverCfg)
+				if err != nil {
+					return
+				}
+				defer sconn.Close()
+				go ssh.DiscardRequests(reqs)
+				for newCh := range chans {
+					if newCh.ChannelType() != "direct-tcpip" {
+						newCh.Reject(ssh.UnknownChannelType, "unsupported channel")
+						continue
+					}
+					go forward(newCh)
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// forward connects a direct-tcpip channel to its destination.
+func forward(newCh ssh.NewChannel) {
+	// payload: string host, uint32 port, string origin host, uint32 origin port
+	data := newCh.ExtraData()
+	n := binary.BigEndian.Uint32(data)
+	host := string(data[4 : 4+n])
+	port := binary.BigEndian.Uint32(data[4+n:])
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		io.Copy(ch, target)
+		ch.CloseWrite()
+	}()
+	io.Copy(target, ch)
+	target.Close()
+	ch.Close()
+}
+
+func TestDial_Jump(t *testing.T) {
+	jump1, jump2, target := serveSSH(t), serveSSH(t), serveSSH(t)
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCfg := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("password")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	badCfg := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("wrong")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	tests := []struct {
+		name  string
+		jumps []Jump
+		ok    bool
+	}{
+		{"direct", nil, true},
+		{"one jump", []Jump{{jump1, clientCfg}}, true},
+		{"two jumps", []Jump{{jump1, clientCfg}, {jump2, clientCfg}}, true},
+		{"bad jump", []Jump{{jump1, clientCfg}, {jump2, badCfg}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, jumps, err := dial(target, clientCfg, test.jumps)
+			switch {
+			case err != nil && test.ok:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !test.ok:
+				t.Fatal("expected error, got none")
+			case err != nil && !test.ok:
+				t.Logf("got expected error: %v", err)
+				return
+			}
+			c := &Client{client: client, jumps: jumps, addr: remoteAddr(host, client, len(test.jumps) > 0)}
+			if len(jumps) != len(test.jumps) {
+				t.Errorf("want %d jump clients, got %d", len(test.jumps), len(jumps))
+			}
+			if c.Addr() != host {
+				t.Errorf("want addr %s, got %s", host, c.Addr())
+			}
+			if err := c.Close(); err != nil {
+				t.Errorf("unexpected error closing client: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// EnableSecret is the password sent when entering privileged mode on devices
+// that require it.
+var EnableSecret string
+
+// Driver is the platform-specific behavior of a session on a remote device.
+type Driver struct {
+	Paging       []string       // commands that disable paging of output
+	Enable       string         // command that enters privileged mode, if any
+	Unprivileged *regexp.Regexp // prompt when not in privileged mode
+	Logout       Command        // command that ends the session
+
+	Configure       string  // command that enters configuration mode
+	End             string  // command that leaves configuration mode
+	Commit          string  // command that commits configuration changes, if needed
+	CommitConfirmed string  // format of Commit with minutes until the changes are rolled back unless confirmed
+	CommitDelay     string  // format of a command entered before the changes with minutes until they are rolled back unless confirmed
+	Confirm         string  // command in configuration mode that confirms a commit confirmed or delayed
+	Abort           string  // command that leaves configuration mode discarding uncommitted changes
+	Checkpoint      Command // command that saves the running configuration for Rollback, on platforms without Abort
+	Rollback        Command // command in configuration mode that restores the configuration saved by Checkpoint
+
+	ShowConfig  string  // command that shows the running configuration
+	ShowStartup string  // command that shows the startup configuration, if any
+	Replace     Command // command that replaces the running configuration with the configuration entered, if supported
+}
+
+// ciscoIOS is the driver of Cisco IOS and IOS XE devices.
+var ciscoIOS = Driver{
+	Paging:       []string{"terminal length 0"},
+	Enable:       "enable",
+	Unprivileged: regexp.MustCompile(`>$`),
+	Logout:       Command{Cmd: "exit"},
+	Configure:    "configure terminal",
+	End:          "end",
+	ShowConfig:   "show running-config",
+	ShowStartup:  "show startup-config",
+}
+
+// comwareCheckpoint is the file that the running configuration of Comware
+// devices is saved to before it is changed, to roll back to if a change fails.
+const comwareCheckpoint = "flash:/netcfg-rollback.cfg"
+
+// drivers are the drivers for each vendor and OS, as identified by the
+// sysObjectID or sysDescr of a device. A vendor's driver is used if its OS is
+// unknown, so it does not enter privileged mode or disable paging with
+// commands that not every platform of the vendor has, i.e. Cisco wireless
+// LAN controllers.
+var drivers = map[string]Driver{
+	"CISCO": {
+		Logout:      Command{Cmd: "exit"},
+		Configure:   "configure terminal",
+		End:         "end",
+		ShowConfig:  "show running-config",
+		ShowStartup: "show startup-config",
+	},
+	"CISCO IOS":    ciscoIOS,
+	"CISCO IOS XE": ciscoIOS,
+	"CISCO IOS XR": {
+		Paging:          []string{"terminal length 0"},
+		Logout:          Command{Cmd: "exit"},
+		Configure:       "configure terminal",
+		End:             "end",
+		Commit:          "commit",
+		CommitConfirmed: "commit confirmed minutes %d",
+		Confirm:         "commit",
+		Abort:           "abort",
+		ShowConfig:      "show running-config",
+		Replace: Command{
+			Cmd:    "commit replace",
+			Expect: regexp.MustCompile(`(?i)proceed\? ?\[no\]:?`),
+			Answer: "yes",
+		},
+	},
+	"CISCO NX-OS": {
+		Paging:      []string{"terminal length 0"},
+		Logout:      Command{Cmd: "exit"},
+		Configure:   "configure terminal",
+		End:         "end",
+		ShowConfig:  "show running-config",
+		ShowStartup: "show startup-config",
+	},
+	"HP": {
+		Paging:      []string{"screen-length disable"},
+		Logout:      Command{Cmd: "quit"},
+		Configure:   "system-view",
+		End:         "return",
+		ShowConfig:  "display current-configuration",
+		ShowStartup: "display saved-configuration",
+	},
+	"HP COMWARE": {
+		Paging:      []string{"screen-length disable"},
+		Logout:      Command{Cmd: "quit"},
+		Configure:   "system-view",
+		End:         "return",
+		CommitDelay: "configuration commit delay %d",
+		Confirm:     "configuration commit",
+		Checkpoint: Command{
+			Cmd:    "save " + comwareCheckpoint,
+			Expect: regexp.MustCompile(`(?i)(?:continue|overwrite)\? ?\[y/n\]:?`),
+			Answer: "y",
+		},
+		Rollback: Command{
+			Cmd:    "configuration replace file " + comwareCheckpoint,
+			Expect: regexp.MustCompile(`(?i)save current configuration\? ?\[y/n\]:?`),
+			Answer: "n",
+		},
+		ShowConfig:  "display current-configuration",
+		ShowStartup: "display saved-configuration",
+	},
+	"HP PROCURVE": {
+		Paging:       []string{"no page"},
+		Enable:       "enable",
+		Unprivileged: regexp.MustCompile(`>$`),
+		Logout: Command{
+			Cmd:    "logout",
+			Expect: regexp.MustCompile(`(?i)log ?out\b.*\[y/n\]`),
+			Answer: "y",
+		},
+		Configure:   "configure terminal",
+		End:         "end",
+		ShowConfig:  "show running-config",
+		ShowStartup: "show config",
+	},
+}
+
+// driverFor returns the driver for a vendor and OS. Devices of an unknown
+// vendor get a driver that does nothing.
+func driverFor(vendor, os string) Driver {
+	if d, ok := drivers[strings.ToUpper(strings.TrimSpace(vendor+" "+os))]; ok {
+		return d
+	}
+	return drivers[strings.ToUpper(vendor)]
+}
+
+// open prepares a session for running commands by entering privileged mode
+// and disabling paging, so that commands do not wait at a "--More--" prompt.
+// A session that starts at a login prompt is left as is.
+func (s *Session) open() error {
+	if s.login {
+		// the commands log in to the device themselves, so there is no
+		// command line to prepare yet
+		return nil
+	}
+	if s.driver.Enable != "" && s.driver.Unprivileged != nil && s.driver.Unprivileged.MatchString(s.line) {
+		if err := s.enable(); err != nil {
+			return fmt.Errorf("could not enter privileged mode: %v", err)
+		}
+	}
+
+	// not every platform version supports every paging command, so errors
+	// are ignored
+	for _, cmd := range s.driver.Paging {
+		if out := s.Run(cmd); out.Err != nil && s.broken {
+			return fmt.Errorf("could not disable paging: %v", out.Err)
+		}
+	}
+	return nil
+}
+
+// enable enters privileged mode, sending EnableSecret if asked for a password.
+func (s *Session) enable() error {
+	_, i, err := s.send(s.driver.Enable, s.prompt, questionPrompt)
+	if err != nil {
+		return err
+	}
+	if i == 1 {
+		// the password is not echoed, so the output is not trimmed of it
+		if _, err := s.stdin.Write([]byte(EnableSecret + "\n")); err != nil {
+			return fmt.Errorf("failed to send enable secret: %v", err)
+		}
+		if _, i, err = s.expect(s.prompt, questionPrompt); err != nil {
+			return err
+		}
+	}
+	if i != 0 || s.driver.Unprivileged.MatchString(s.line) {
+		return errors.New("access denied, check enable_secret")
+	}
+	return nil
+}
+
+// logout ends a session with the driver's logout command, unless the session
+// was already closed or is stuck waiting for a command to finish.
+func (s *Session) logout() {
+	if s.closed || s.broken || s.driver.Logout.Cmd == "" {
+		return
+	}
+	s.RunCommand(s.driver.Logout)
+}
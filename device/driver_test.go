@@ -0,0 +1,91 @@
+package device
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDriverFor(t *testing.T) {
+	tests := []struct {
+		vendor, os string
+		paging     string
+		logout     string
+	}{
+		{"CISCO", "IOS", "terminal length 0", "exit"},
+		{"CISCO", "IOS XE", "terminal length 0", "exit"},
+		{"CISCO", "IOS XR", "terminal length 0", "exit"},
+		{"CISCO", "", "", "exit"},
+		{"HP", "Comware", "screen-length disable", "quit"},
+		{"HP", "ProCurve", "no page", "logout"},
+		{"", "", "", ""},
+	}
+	for _, test := range tests {
+		d := driverFor(test.vendor, test.os)
+		var paging string
+		if len(d.Paging) > 0 {
+			paging = d.Paging[0]
+		}
+		if paging != test.paging || d.Logout.Cmd != test.logout {
+			t.Errorf("%s %s: want %q and %q, got %q and %q", test.vendor, test.os, test.paging, test.logout, paging, d.Logout.Cmd)
+		}
+	}
+}
+
+func TestClient_Run_Enable(t *testing.T) {
+	responses := map[string]response{
+		"enable":            {prompt: "Password: "},
+		"s3cret":            {prompt: "Switch#"},
+		"terminal length 0": {prompt: "Switch#"},
+		"show clock":        {out: "*12:00:00.000 UTC Mon Jan 1 2018\r\n", prompt: "Switch#"},
+		"exit":              {exit: true},
+	}
+	client := serveCLI(t, "CISCO", "Switch>", responses)
+	client.os = "IOS"
+
+	defer func(secret string) { EnableSecret = secret }(EnableSecret)
+	EnableSecret = "s3cret"
+	outs, err := client.Run("show clock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outs) != 1 || string(outs[0].Out) != "*12:00:00.000 UTC Mon Jan 1 2018" {
+		t.Errorf("want only the output of show clock, got %v", outs)
+	}
+
+	// privileged mode is entered once per session
+	if _, err := client.Run("show clock"); err != nil {
+		t.Fatal(err)
+	}
+
+	client = serveCLI(t, "CISCO", "Switch>", responses)
+	client.os = "IOS"
+	EnableSecret = "wrong"
+	_, err = client.Run("show clock")
+	if err == nil || !strings.Contains(err.Error(), "privileged mode") {
+		t.Errorf("want privileged mode error, got %v", err)
+	}
+}
+
+func TestClient_Run_Login(t *testing.T) {
+	for _, os := range []string{"", "IOS"} {
+		t.Run("CISCO "+os, func(t *testing.T) {
+			client := serveCLI(t, "CISCO", "User: ", map[string]response{
+				// a paging command sent at the login prompt fails the login
+				"terminal length 0": {out: "Login incorrect\r\n", exit: true},
+				"user":              {prompt: "Password: "},
+				"password":          {prompt: "(Cisco Controller) >"},
+				"show ap summary":   {out: "Number of APs.................................... 0\r\n", prompt: "(Cisco Controller) >"},
+				"logout":            {exit: true},
+			})
+			client.os = os
+
+			outs, err := client.Run("user", "password", "show ap summary", "logout")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(outs) != 4 || !strings.HasPrefix(string(outs[2].Out), "Number of APs") {
+				t.Errorf("want the output of show ap summary, got %v", outs)
+			}
+		})
+	}
+}
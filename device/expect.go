@@ -0,0 +1,382 @@
+package device
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultCmdTimeout is the time to wait for a command to finish when
+// Timeout is not set.
+const DefaultCmdTimeout = 30 * time.Second
+
+// ErrSessionClosed is returned when the remote device closes the session
+// before a command finishes, i.e. after a logout command.
+var ErrSessionClosed = errors.New("session closed by remote host")
+
+var (
+	// prompts are the regular expressions that match the command prompt of
+	// each vendor's devices at the end of the session output, after the last
+	// newline.
+	prompts = map[string]*regexp.Regexp{
+		// Switch>, Switch#, Switch(config-if)#, RP/0/RSP0/CPU0:router#,
+		// switch(config)# and (Cisco Controller) >
+		"CISCO": regexp.MustCompile(`(?:^|\n)(?:[\w.\-@/:]+(?:\([\w.\-/ ]+\))?[>#]|\([\w .\-]+\) ?>)[ \t]*\z`),
+
+		// <HPE>, [HPE], [~HPE-GigabitEthernet1/0/1], ProCurve# and
+		// ProCurve(config)#
+		"HP": regexp.MustCompile(`(?:^|\n)(?:[<\[]~?[\w.\-/:]+[>\]]|[\w.\-]+(?:\([\w.\-/ ]+\))?[>#])[ \t]*\z`),
+	}
+
+	// genericPrompt matches the command prompt of devices of any vendor.
+	genericPrompt = regexp.MustCompile(`(?:^|\n)(?:[\w.\-@/:~]+(?:\([\w.\-/ ]+\))?[>#$%]|[<\[]~?[\w.\-/:]+[>\]]|\([\w .\-]+\) ?>)[ \t]*\z`)
+
+	// questionPrompt matches questions and login prompts that expect an
+	// answer, which is sent as the next command.
+	questionPrompt = regexp.MustCompile(`(?i)(?:^|\n)[^\n]*(?:\[confirm\]|\[y(?:es)?/n(?:o)?\]:?|\(y(?:es)?/n(?:o)?\):?|\?|(?:user(?:name)?|login|password):)[ \t]*\z`)
+
+	// errorPatterns are the regular expressions that match the error messages
+	// each vendor's devices print when a command fails.
+	errorPatterns = map[string][]*regexp.Regexp{
+		// % Invalid input detected at '^' marker., % Incomplete command.,
+		// % Ambiguous command:  "sh" and % Failed to commit one or more
+		// configuration items
+		"CISCO": {regexp.MustCompile(`(?m)^\s*% ?(?:Invalid|Incomplete|Ambiguous|Failed)`)},
+
+		// % Unrecognized command found at '^' position., % Incomplete command
+		// found at '^' position., % Too many parameters found at '^' position.
+		// and Invalid input: foo
+		"HP": {regexp.MustCompile(`(?m)^\s*(?:% ?)?(?:Unrecognized command|Incomplete command|Ambiguous command|Too many parameters|Wrong parameter)|^\s*Invalid input:`)},
+	}
+
+	// ansiEscape matches ANSI terminal escape sequences.
+	ansiEscape = regexp.MustCompile(`\x1b(?:\[[0-9;?]*[A-Za-z]|[()][A-Za-z0-9]|[=>EM])`)
+)
+
+// CommandError is the error of a command whose output matches an error
+// pattern.
+type CommandError struct {
+	Line string // line of output that matched the error pattern
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("device reported an error: %s", e.Line)
+}
+
+// Command is a command to run on a remote device.
+type Command struct {
+	Cmd          string         // command to run
+	Expect       *regexp.Regexp // prompt that is answered after the command is sent
+	Answer       string         // answer sent when the Expect prompt appears
+	Timeout      time.Duration  // time to wait for the command, if not the session timeout
+	IgnoreErrors bool           // error messages from the command do not fail the host
+}
+
+// Output is the output of a command run on a remote device.
+type Output struct {
+	Cmd      string        // command that was run
+	Out      []byte        // output of the command
+	Duration time.Duration // time taken to run the command
+	Err      error         // error from running the command
+}
+
+// Session is an interactive shell session on a remote device. Commands are
+// sent one at a time, each after the device prompt appears, so that the
+// output of each command can be captured separately.
+type Session struct {
+	Timeout time.Duration // time to wait for a command to finish
+
+	session *ssh.Session     // underlying SSH session
+	stdin   io.WriteCloser   // remote standard input
+	prompt  *regexp.Regexp   // device command prompt
+	errors  []*regexp.Regexp // error messages in command output
+	driver  Driver           // platform-specific behavior of the session
+	line    string           // last line matched by Expect, i.e. the prompt
+	chunks  chan []byte      // output read from the remote standard output
+	done    chan struct{}    // closed when the session is closed
+	once    sync.Once        // closes done once
+	buf     bytes.Buffer     // output not yet returned
+	closed  bool             // the remote device closed the session
+	broken  bool             // a command timed out before the prompt appeared
+	login   bool             // the session started at a question or login prompt
+	opened  bool             // the session was prepared for running commands
+}
+
+// NewSession starts an interactive shell session on the remote device and
+// waits for the device prompt.
+func (c *Client) NewSession() (*Session, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{
+		Timeout: Timeout,
+		session: session,
+		chunks:  make(chan []byte),
+		done:    make(chan struct{}),
+	}
+	s.setPlatform(c.vendor, c.os)
+
+	s.stdin, err = session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("could not create pipe to remote standard input: %v", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("could not create pipe to remote standard output: %v", err)
+	}
+
+	// some devices do not support terminals, so ignore any error
+	modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 38400, ssh.TTY_OP_OSPEED: 38400}
+	session.RequestPty("vt100", 0, 511, modes)
+
+	if err := session.Shell(); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("could not start remote shell: %v", err)
+	}
+	go s.read(stdout)
+
+	_, i, err := s.expect(s.prompt, questionPrompt)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("could not find device prompt: %v", err)
+	}
+	s.login = i == 1
+	return s, nil
+}
+
+// setPlatform sets the prompt, error messages and driver of a session for the
+// vendor and OS of the device.
+func (s *Session) setPlatform(vendor, os string) {
+	s.prompt = promptFor(vendor)
+	s.errors = errorsFor(vendor)
+	s.driver = driverFor(vendor, os)
+}
+
+// promptFor returns the command prompt regexp for a vendor.
+func promptFor(vendor string) *regexp.Regexp {
+	if prompt, ok := prompts[strings.ToUpper(vendor)]; ok {
+		return prompt
+	}
+	return genericPrompt
+}
+
+// errorsFor returns the error message regexps for a vendor, including any
+// ErrorPatterns. If the vendor is unknown, the error messages of all vendors
+// are matched.
+func errorsFor(vendor string) []*regexp.Regexp {
+	patterns, ok := errorPatterns[strings.ToUpper(vendor)]
+	if !ok {
+		patterns = nil
+		for _, p := range errorPatterns {
+			patterns = append(patterns, p...)
+		}
+	}
+	return append(append([]*regexp.Regexp(nil), patterns...), ErrorPatterns...)
+}
+
+// read sends the output of the remote session to the chunks channel until
+// the session is closed, by the remote device or by Close.
+func (s *Session) read(r io.Reader) {
+	defer close(s.chunks)
+	for {
+		b := make([]byte, 4096)
+		n, err := r.Read(b)
+		if n > 0 {
+			select {
+			case s.chunks <- b[:n]:
+			case <-s.done:
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Run sends a command to the remote device and waits for the device prompt,
+// or a question such as "[confirm]", then returns the output of the command
+// without the echoed command or the prompt. If the output matches an error
+// message, the error is a *CommandError.
+func (s *Session) Run(cmd string) Output {
+	return s.RunCommand(Command{Cmd: cmd})
+}
+
+// maxAnswers is how many times the expected prompt of a command is answered,
+// so that a device that asks again after a wrong answer is not answered
+// forever.
+const maxAnswers = 3
+
+// RunCommand is like Run, but also answers the command's expected prompt each
+// time it appears, i.e. a confirmation after a question, and waits for the
+// command's timeout, if set.
+func (s *Session) RunCommand(cmd Command) Output {
+	if cmd.Timeout > 0 {
+		defer func(timeout time.Duration) { s.Timeout = timeout }(s.Timeout)
+		s.Timeout = cmd.Timeout
+	}
+	patterns := []*regexp.Regexp{s.prompt, questionPrompt}
+	if cmd.Expect != nil {
+		// the expected prompt is matched first since it may also be a question
+		patterns = append([]*regexp.Regexp{cmd.Expect}, patterns...)
+	}
+
+	start := time.Now()
+	out, i, err := s.send(cmd.Cmd, patterns...)
+	for n := 0; err == nil && cmd.Expect != nil && i == 0 && n < maxAnswers; n++ {
+		var answer []byte
+		answer, i, err = s.send(cmd.Answer, patterns...)
+		if len(out) > 0 && len(answer) > 0 {
+			out = append(out, '\n')
+		}
+		out = append(out, answer...)
+	}
+	if err == nil {
+		err = s.check(out)
+	}
+	return Output{Cmd: cmd.Cmd, Out: out, Duration: time.Since(start), Err: err}
+}
+
+// check returns a *CommandError for the first line of the output of a
+// command that matches one of the session's error messages.
+func (s *Session) check(out []byte) error {
+	first := -1
+	for _, p := range s.errors {
+		if loc := p.FindIndex(out); loc != nil && (first < 0 || loc[0] < first) {
+			first = loc[0]
+		}
+	}
+	if first < 0 {
+		return nil
+	}
+	start := bytes.LastIndexByte(out[:first], '\n') + 1
+	end := bytes.IndexByte(out[first:], '\n')
+	if end < 0 {
+		end = len(out)
+	} else {
+		end += first
+	}
+	return &CommandError{Line: strings.TrimSpace(string(out[start:end]))}
+}
+
+// Send sends a line of input to the remote device and waits for the output
+// to match one of the patterns. The output is returned without the echoed
+// input or the matched text.
+func (s *Session) Send(line string, patterns ...*regexp.Regexp) ([]byte, error) {
+	out, _, err := s.send(line, patterns...)
+	return out, err
+}
+
+// send is like Send, but also returns the index of the matched pattern.
+func (s *Session) send(line string, patterns ...*regexp.Regexp) ([]byte, int, error) {
+	if s.closed {
+		return nil, -1, ErrSessionClosed
+	}
+	if _, err := s.stdin.Write([]byte(line + "\n")); err != nil {
+		return nil, -1, fmt.Errorf("failed to send %q: %v", line, err)
+	}
+	out, i, err := s.expect(patterns...)
+	if err == ErrSessionClosed {
+		// the command ended the session, i.e. exit or logout
+		return trimEcho(out, line), i, err
+	}
+	if err != nil {
+		return trimEcho(out, line), i, fmt.Errorf("%q: %v", line, err)
+	}
+	return trimEcho(out, line), i, nil
+}
+
+// Expect reads the session output until its last line, which no newline ends
+// yet, matches one of the patterns and returns the output before the line of
+// the match. The output is cleaned of carriage returns and terminal escape
+// sequences.
+func (s *Session) Expect(patterns ...*regexp.Regexp) ([]byte, error) {
+	out, _, err := s.expect(patterns...)
+	return out, err
+}
+
+// expect is like Expect, but also returns the index of the matched pattern.
+func (s *Session) expect(patterns ...*regexp.Regexp) ([]byte, int, error) {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultCmdTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		out := s.buf.Bytes()
+
+		// prompts are always on the last line, which no newline ends yet,
+		// so only match against it rather than the whole output: a line
+		// that ends a read is not a prompt once its newline arrives
+		last := bytes.LastIndexByte(out, '\n')
+		if last < 0 {
+			last = 0
+		}
+		for i, p := range patterns {
+			if loc := p.FindIndex(out[last:]); loc != nil {
+				// drop the whole line of the match, i.e. the text of a question
+				end := last + loc[0]
+				if end == len(out) || out[end] != '\n' {
+					end = bytes.LastIndexByte(out[:end], '\n') + 1
+				}
+				s.line = strings.TrimSpace(string(out[end:]))
+				out = append([]byte(nil), out[:end]...)
+				s.buf.Reset()
+				return out, i, nil
+			}
+		}
+		select {
+		case chunk, ok := <-s.chunks:
+			if !ok {
+				s.closed = true
+				out = append([]byte(nil), out...)
+				s.buf.Reset()
+				return out, -1, ErrSessionClosed
+			}
+			s.buf.Write(clean(chunk))
+		case <-deadline.C:
+			s.broken = true
+			return out, -1, fmt.Errorf("timed out after %v waiting for prompt", timeout)
+		}
+	}
+}
+
+// Close closes the session.
+func (s *Session) Close() error {
+	s.once.Do(func() { close(s.done) })
+	s.stdin.Close()
+	return s.session.Close()
+}
+
+// clean removes carriage returns, backspaces and terminal escape sequences
+// from session output.
+func clean(b []byte) []byte {
+	b = ansiEscape.ReplaceAll(b, nil)
+	b = bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+	b = bytes.Replace(b, []byte("\r"), nil, -1)
+	return bytes.Replace(b, []byte("\b"), nil, -1)
+}
+
+// trimEcho removes the echoed command from the start of a command's output
+// and any leading or trailing blank lines.
+func trimEcho(out []byte, cmd string) []byte {
+	out = bytes.TrimLeft(out, "\n")
+	if i := bytes.IndexByte(out, '\n'); i >= 0 && strings.TrimSpace(string(out[:i])) == strings.TrimSpace(cmd) {
+		out = out[i+1:]
+	} else if strings.TrimSpace(string(out)) == strings.TrimSpace(cmd) {
+		out = nil
+	}
+	return bytes.TrimRight(out, "\n ")
+}
@@ -0,0 +1,442 @@
+package device
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// cliSessions counts the sessions started on the servers of serveCLI.
+var cliSessions int32
+
+// response is the response of a fake device to a command.
+type response struct {
+	out    string // output of the command
+	prompt string // prompt written after the output, if not the device prompt
+	exit   bool   // close the session after the output
+	hang   bool   // never write a prompt
+}
+
+// serveCLI starts a local SSH server emulating the command line of a network
+// device with the prompt, and returns a client connected to it. Commands not
+// in responses are answered with the output "% Invalid input detected".
+func serveCLI(t *testing.T, vendor, prompt string, responses map[string]response) *Client {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCfg := &ssh.ServerConfig{NoClientAuth: true}
+	serverCfg.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sconn, chans, reqs, err := ssh.NewServerConn(conn, serverCfg)
+				if err != nil {
+					return
+				}
+				defer sconn.Close()
+				go ssh.DiscardRequests(reqs)
+				for newCh := range chans {
+					ch, reqs, err := newCh.Accept()
+					if err != nil {
+						continue
+					}
+					go func() {
+						for req := range reqs {
+							req.Reply(req.Type == "shell" || req.Type == "pty-req", nil)
+						}
+					}()
+					atomic.AddInt32(&cliSessions, 1)
+					go runCLI(ch, prompt, responses)
+				}
+			}()
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "user",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		l.Close()
+	})
+	return &Client{client: client, vendor: vendor}
+}
+
+// runCLI emulates a device command line on a session channel.
+func runCLI(ch ssh.Channel, prompt string, responses map[string]response) {
+	defer ch.Close()
+	fmt.Fprintf(ch, "\r\nWelcome\r\n\r\n%s", prompt)
+	r := bufio.NewReader(ch)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		fmt.Fprintf(ch, "%s\r\n", cmd)
+		res, ok := responses[cmd]
+		if !ok {
+			res = response{out: "                ^\r\n% Invalid input detected at '^' marker.\r\n"}
+		}
+		fmt.Fprint(ch, res.out)
+		switch {
+		case res.exit:
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			return
+		case res.hang:
+			continue
+		case res.prompt != "":
+			fmt.Fprint(ch, res.prompt)
+		default:
+			fmt.Fprintf(ch, "\r\n%s", prompt)
+		}
+	}
+}
+
+func TestClient_Run(t *testing.T) {
+	client := serveCLI(t, "CISCO", "Switch#", map[string]response{
+		"terminal length 0": {},
+		"show clock":        {out: "*12:00:00.000 UTC Mon Jan 1 2018\r\n"},
+		"copy run start":    {prompt: "Destination filename [startup-config]? "},
+		"":                  {out: "Building configuration...\r\n[OK]\r\n"},
+		"exit":              {exit: true},
+	})
+	outs, err := client.Run("terminal length 0", "show clock", "copy run start", "", "exit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Output{
+		{Cmd: "terminal length 0", Out: []byte("")},
+		{Cmd: "show clock", Out: []byte("*12:00:00.000 UTC Mon Jan 1 2018")},
+		{Cmd: "copy run start", Out: []byte("")},
+		{Cmd: "", Out: []byte("Building configuration...\n[OK]")},
+		{Cmd: "exit", Out: []byte("")},
+	}
+	if len(outs) != len(want) {
+		t.Fatalf("want %d outputs, got %d", len(want), len(outs))
+	}
+	for i := range want {
+		if outs[i].Cmd != want[i].Cmd || string(outs[i].Out) != string(want[i].Out) || outs[i].Err != nil {
+			t.Errorf("want %q: %q, got %q: %q (%v)", want[i].Cmd, want[i].Out, outs[i].Cmd, outs[i].Out, outs[i].Err)
+		}
+	}
+}
+
+func TestClient_Run_Errors(t *testing.T) {
+	client := serveCLI(t, "HP", "<HPE>", map[string]response{
+		"display clock": {out: "12:00:00 UTC Mon 01/01/2018\r\n"},
+		"reboot":        {hang: true},
+		"quit":          {exit: true},
+	})
+
+	defer func(timeout time.Duration) { Timeout = timeout }(Timeout)
+	Timeout = 100 * time.Millisecond
+
+	outs, err := client.Run("display clock", "reboot", "display clock")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("want timeout error, got %v", err)
+	}
+	if len(outs) != 2 || outs[1].Err == nil {
+		t.Errorf("want error for second command, got %v", outs)
+	}
+
+	outs, err = client.Run("quit", "display clock")
+	if err == nil || !strings.Contains(err.Error(), "session closed") {
+		t.Errorf("want session closed error, got %v", err)
+	}
+	if len(outs) != 1 {
+		t.Errorf("want 1 output, got %d", len(outs))
+	}
+}
+
+func TestClient_Run_CommandErrors(t *testing.T) {
+	client := serveCLI(t, "CISCO", "Switch#", map[string]response{
+		"show clock": {out: "*12:00:00.000 UTC Mon Jan 1 2018\r\n"},
+		"vlan 5000":  {out: "Error: vlan 5000 is out of range\r\n"},
+	})
+
+	outs, err := client.Run("show foo", "show clock")
+	if err == nil || err.Error() != "1 of 2 commands failed" {
+		t.Errorf("want 1 of 2 commands failed, got %v", err)
+	}
+	if len(outs) != 2 {
+		t.Fatalf("want 2 outputs, got %d", len(outs))
+	}
+	if cmdErr, ok := outs[0].Err.(*CommandError); !ok || cmdErr.Line != "% Invalid input detected at '^' marker." {
+		t.Errorf("want command error for %q, got %v", outs[0].Cmd, outs[0].Err)
+	}
+	if outs[1].Err != nil {
+		t.Errorf("want no error for %q, got %v", outs[1].Cmd, outs[1].Err)
+	}
+
+	defer func(stop bool) { StopOnError = stop }(StopOnError)
+	StopOnError = true
+	outs, err = client.Run("show foo", "show clock")
+	if err == nil || !strings.Contains(err.Error(), "1 commands not run") {
+		t.Errorf("want commands not run error, got %v", err)
+	}
+	if len(outs) != 1 {
+		t.Errorf("want 1 output, got %d", len(outs))
+	}
+
+	defer func(patterns []*regexp.Regexp) { ErrorPatterns = patterns }(ErrorPatterns)
+	ErrorPatterns = []*regexp.Regexp{regexp.MustCompile(`(?m)^Error:`)}
+	outs, err = client.Run("vlan 5000", "show clock")
+	if err == nil || len(outs) != 1 {
+		t.Fatalf("want error for custom pattern, got %v", err)
+	}
+	if cmdErr, ok := outs[0].Err.(*CommandError); !ok || cmdErr.Line != "Error: vlan 5000 is out of range" {
+		t.Errorf("want command error for %q, got %v", outs[0].Cmd, outs[0].Err)
+	}
+}
+
+func TestClient_RunCommands(t *testing.T) {
+	client := serveCLI(t, "CISCO", "Switch#", map[string]response{
+		"vlan 10 name": {prompt: "Enter VLAN name: "},
+		"core":         {out: "VLAN 10 named core\r\n"},
+		"show clock":   {out: "*12:00:00.000 UTC Mon Jan 1 2018\r\n"},
+		"write memory": {hang: true},
+	})
+
+	outs, err := client.RunCommands(
+		Command{Cmd: "vlan 10 name", Expect: regexp.MustCompile(`VLAN name:`), Answer: "core"},
+		Command{Cmd: "show clock", Expect: regexp.MustCompile(`VLAN name:`), Answer: "core"},
+		Command{Cmd: "no vlan 999", IgnoreErrors: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"VLAN 10 named core", "*12:00:00.000 UTC Mon Jan 1 2018", "                ^\n% Invalid input detected at '^' marker."}
+	if len(outs) != len(want) {
+		t.Fatalf("want %d outputs, got %d", len(want), len(outs))
+	}
+	for i := range want {
+		if string(outs[i].Out) != want[i] {
+			t.Errorf("%q: want %q, got %q", outs[i].Cmd, want[i], outs[i].Out)
+		}
+	}
+	if _, ok := outs[2].Err.(*CommandError); !ok {
+		t.Errorf("want command error for ignored command, got %v", outs[2].Err)
+	}
+
+	start := time.Now()
+	outs, err = client.RunCommands(Command{Cmd: "write memory", Timeout: 100 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("want timeout error, got %v", err)
+	}
+	if d := time.Since(start); d > DefaultCmdTimeout/2 {
+		t.Errorf("command timeout not used, took %v", d)
+	}
+}
+
+func TestClient_Session(t *testing.T) {
+	crlf := func(s string) string { return strings.Replace(s, "\n", "\r\n", -1) + "\r\n" }
+	client := serveCLI(t, "", "switch-1#", map[string]response{
+		"show version":        {out: crlf(iosVersion)},
+		"show running-config": {out: crlf("hostname switch-1\nend")},
+		"show clock":          {out: "*12:00:00.000 UTC Mon Jan 1 2018\r\n"},
+		"configure terminal":  {prompt: "switch-1(config)#"},
+		"hostname switch-1":   {prompt: "switch-1(config)#"},
+		"end":                 {},
+		"exit":                {exit: true},
+	})
+	start := atomic.LoadInt32(&cliSessions)
+
+	m, err := client.sshFacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.vendor, client.os = m["vendor"], m["os"]
+	saved, err := client.RunningConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Run("show clock"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Configure(ConfigMode{}, Command{Cmd: "hostname switch-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Restore(saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&cliSessions) - start; n != 1 {
+		t.Errorf("want 1 session, got %d", n)
+	}
+}
+
+func TestSession_Read(t *testing.T) {
+	s := &Session{chunks: make(chan []byte), done: make(chan struct{})}
+	returned := make(chan struct{})
+	go func() {
+		s.read(strings.NewReader("switch-1#"))
+		close(returned)
+	}()
+
+	// nothing receives the output, i.e. after a command timed out
+	close(s.done)
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("read did not return after the session was closed")
+	}
+}
+
+func TestSession_Expect(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{
+			name:   "question",
+			chunks: []string{"interface Gi0/1\r\n  description who owns this?\r\n", " shutdown\r\n!\r\nswitch-1#"},
+			want:   "interface Gi0/1\n  description who owns this?\n shutdown\n!",
+		},
+		{
+			name:   "prompt",
+			chunks: []string{"banner motd ^C\r\nswitch-2#\r\n", "^C\r\n!\r\nswitch-1#"},
+			want:   "banner motd ^C\nswitch-2#\n^C\n!",
+		},
+		{
+			name:   "user prompt",
+			chunks: []string{"banner login ^C\r\nswitch-2>\r\n", "^C\r\n!\r\nswitch-1#"},
+			want:   "banner login ^C\nswitch-2>\n^C\n!",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Session{Timeout: time.Second, prompt: promptFor("CISCO"), chunks: make(chan []byte)}
+			go func() {
+				for _, chunk := range test.chunks {
+					s.chunks <- []byte(chunk)
+				}
+			}()
+			out, i, err := s.expect(s.prompt, questionPrompt)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if i != 0 || string(out) != test.want || s.line != "switch-1#" {
+				t.Errorf("want %q before the prompt, got %q before %q (%d)", test.want, out, s.line, i)
+			}
+		})
+	}
+}
+
+func TestErrorPatterns(t *testing.T) {
+	tests := []struct {
+		vendor string
+		out    string
+		want   bool
+	}{
+		{"CISCO", "       ^\n% Invalid input detected at '^' marker.", true},
+		{"CISCO", "% Incomplete command.", true},
+		{"CISCO", `% Ambiguous command:  "sh"`, true},
+		{"CISCO", "Interface Gi1/0/1 is up\nDescription: 50% Invalid", false},
+		{"HP", "% Unrecognized command found at '^' position.", true},
+		{"HP", "% Too many parameters found at '^' position.", true},
+		{"HP", "Invalid input: foo", true},
+		{"HP", "Current time: 12:00:00", false},
+		{"generic", "% Invalid input detected at '^' marker.", true},
+		{"generic", "Unrecognized command found at '^' position.", true},
+	}
+	for _, test := range tests {
+		s := &Session{errors: errorsFor(test.vendor)}
+		if got := s.check([]byte(test.out)) != nil; got != test.want {
+			t.Errorf("%s %q: want %t, got %t", test.vendor, test.out, test.want, got)
+		}
+	}
+}
+
+func TestPrompts(t *testing.T) {
+	tests := []struct {
+		vendor string
+		prompt string
+		want   bool
+	}{
+		{"CISCO", "Switch>", true},
+		{"CISCO", "Switch#", true},
+		{"CISCO", "Switch(config-if)#", true},
+		{"CISCO", "switch(config)# ", true},
+		{"CISCO", "RP/0/RSP0/CPU0:router#", true},
+		{"CISCO", "(Cisco Controller) >", true},
+		{"CISCO", "Building configuration...", false},
+		{"HP", "<HPE>", true},
+		{"HP", "[HPE]", true},
+		{"HP", "[~HPE-GigabitEthernet1/0/1]", true},
+		{"HP", "ProCurve(config)# ", true},
+		{"HP", "  Slot 1", false},
+		{"", "user@host:~$ ", true},
+		{"", "<HPE>", true},
+		{"", "Switch#", true},
+		{"", "Interface status:", false},
+	}
+	for _, test := range tests {
+		if got := promptFor(test.vendor).MatchString("output\n" + test.prompt); got != test.want {
+			t.Errorf("%s %q: want %t, got %t", test.vendor, test.prompt, test.want, got)
+		}
+	}
+}
+
+func TestQuestionPrompt(t *testing.T) {
+	for _, prompt := range []string{
+		"Proceed with reload? [confirm]",
+		"Destination filename [startup-config]? ",
+		"Would you like to save them now? (y/N)",
+		"Are you sure? [Y/N]:",
+		"User:",
+		"Password: ",
+	} {
+		if !questionPrompt.MatchString("output\n" + prompt) {
+			t.Errorf("%q: want match", prompt)
+		}
+	}
+}
+
+func TestTrimEcho(t *testing.T) {
+	tests := []struct {
+		out, cmd, want string
+	}{
+		{"show clock\n12:00\n", "show clock", "12:00"},
+		{"\nshow clock\n12:00\n\n", "show clock", "12:00"},
+		{"show clock", "show clock", ""},
+		{"12:00\n", "show clock", "12:00"},
+	}
+	for _, test := range tests {
+		if got := string(trimEcho([]byte(test.out), test.cmd)); got != test.want {
+			t.Errorf("want %q, got %q", test.want, got)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package device
+
+import "strings"
+
+// system is what an entry of the sysObjectID table says about a device.
+// Empty fields are left to the sysDescr of the device.
+type system struct {
+	vendor string // vendor of the device
+	os     string // operating system of the device
+	model  string // model of the device
+}
+
+// objectIDs maps sysObjectID values to devices. An entry also matches every
+// OID below it, so vendor enterprise OIDs match all of the vendor's devices
+// and product OIDs match a single model.
+var objectIDs = map[string]system{
+	// Cisco
+	"1.3.6.1.4.1.9":              {vendor: "CISCO"},
+	"1.3.6.1.4.1.9.1.282":        {vendor: "CISCO", model: "WS-C6506"},
+	"1.3.6.1.4.1.9.1.283":        {vendor: "CISCO", model: "WS-C6509"},
+	"1.3.6.1.4.1.9.1.400":        {vendor: "CISCO", model: "WS-C6513"},
+	"1.3.6.1.4.1.9.1.923":        {vendor: "CISCO", os: "IOS XE", model: "ASR1002"},
+	"1.3.6.1.4.1.9.1.924":        {vendor: "CISCO", os: "IOS XE", model: "ASR1004"},
+	"1.3.6.1.4.1.9.1.925":        {vendor: "CISCO", os: "IOS XE", model: "ASR1006"},
+	"1.3.6.1.4.1.9.1.1017":       {vendor: "CISCO", os: "IOS XR", model: "ASR-9010"},
+	"1.3.6.1.4.1.9.1.1018":       {vendor: "CISCO", os: "IOS XR", model: "ASR-9006"},
+	"1.3.6.1.4.1.9.12.3.1.3.612": {vendor: "CISCO", os: "NX-OS", model: "N7K-C7010"},
+	"1.3.6.1.4.1.9.12.3.1.3.613": {vendor: "CISCO", os: "NX-OS", model: "N7K-C7018"},
+
+	// HP ProCurve and Comware
+	"1.3.6.1.4.1.11":             {vendor: "HP"},
+	"1.3.6.1.4.1.11.2.3.7.11":    {vendor: "HP", os: "ProCurve"},
+	"1.3.6.1.4.1.11.2.3.7.11.50": {vendor: "HP", os: "ProCurve", model: "J8697A"},
+	"1.3.6.1.4.1.11.2.3.7.11.51": {vendor: "HP", os: "ProCurve", model: "J8698A"},
+	"1.3.6.1.4.1.25506":          {vendor: "HP", os: "Comware"},
+
+	// other vendors
+	"1.3.6.1.4.1.14823": {vendor: "ARUBA"},
+	"1.3.6.1.4.1.2636":  {vendor: "JUNIPER", os: "JUNOS"},
+	"1.3.6.1.4.1.30065": {vendor: "ARISTA", os: "EOS"},
+	"1.3.6.1.4.1.2011":  {vendor: "HUAWEI", os: "VRP"},
+	"1.3.6.1.4.1.1991":  {vendor: "BROCADE"},
+	"1.3.6.1.4.1.12356": {vendor: "FORTINET", os: "FortiOS"},
+	"1.3.6.1.4.1.25461": {vendor: "PALO ALTO", os: "PAN-OS"},
+	"1.3.6.1.4.1.14988": {vendor: "MIKROTIK", os: "RouterOS"},
+}
+
+// lookupObjectID returns the entry of the sysObjectID table that most
+// specifically matches an OID, and whether there is one.
+func lookupObjectID(oid string) (system, bool) {
+	oid = strings.TrimPrefix(oid, ".")
+	for oid != "" {
+		if sys, ok := objectIDs[oid]; ok {
+			return sys, true
+		}
+		i := strings.LastIndex(oid, ".")
+		if i < 0 {
+			break
+		}
+		oid = oid[:i]
+	}
+	return system{}, false
+}
+
+// parseObjectID identifies a device by the entry of the sysObjectID table
+// that matches its sysObjectID.
+func parseObjectID(objectID, _ string) (Info, bool) {
+	sys, ok := lookupObjectID(objectID)
+	return Info{Vendor: sys.vendor, OS: sys.os, Model: sys.model}, ok
+}
@@ -0,0 +1,109 @@
+package device
+
+import "testing"
+
+func TestLookupObjectID(t *testing.T) {
+	tests := []struct {
+		oid  string
+		ok   bool
+		want system
+	}{
+		{".1.3.6.1.4.1.9.1.1017", true, system{vendor: "CISCO", os: "IOS XR", model: "ASR-9010"}},
+		{"1.3.6.1.4.1.9.1.1017", true, system{vendor: "CISCO", os: "IOS XR", model: "ASR-9010"}},
+		{".1.3.6.1.4.1.9.1.10170", true, system{vendor: "CISCO"}},
+		{".1.3.6.1.4.1.9.1.1208", true, system{vendor: "CISCO"}},
+		{".1.3.6.1.4.1.11.2.3.7.11.87", true, system{vendor: "HP", os: "ProCurve"}},
+		{".1.3.6.1.4.1.25506.11.1.83", true, system{vendor: "HP", os: "Comware"}},
+		{".1.3.6.1.4.1.99", false, system{}},
+		{".1.3.6.1.4.1", false, system{}},
+		{"", false, system{}},
+	}
+	for _, test := range tests {
+		got, ok := lookupObjectID(test.oid)
+		if ok != test.ok || got != test.want {
+			t.Errorf("%q: want %+v (%t), got %+v (%t)", test.oid, test.want, test.ok, got, ok)
+		}
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		name     string
+		objectID string
+		descr    string
+		want     map[string]string
+	}{
+		{
+			name:     "product",
+			objectID: ".1.3.6.1.4.1.9.1.1017",
+			descr:    "Cisco IOS XR Software (Cisco ASR9K Series), Version 5.3.4[Default]\nCopyright (c) 2017 by Cisco Systems, Inc.",
+			want:     map[string]string{"vendor": "CISCO", "os": "IOS XR", "model": "ASR-9010", "version": "Version 5.3.4[Default]"},
+		},
+		{
+			// the product name replaces the model of the sysDescr
+			name:     "product model",
+			objectID: ".1.3.6.1.4.1.11.2.3.7.11.50",
+			descr:    "ProCurve J8697A Switch 5406zl, revision K.15.18.0013, ROM K.15.30",
+			want: map[string]string{
+				"vendor":  "HP",
+				"os":      "ProCurve",
+				"model":   "J8697A",
+				"version": "revision K.15.18.0013, ROM K.15.30",
+			},
+		},
+		{
+			name:     "enterprise",
+			objectID: ".1.3.6.1.4.1.9.1.1208",
+			descr:    "Cisco IOS Software, C2960S Software (C2960S-UNIVERSALK9-M), Version 15.0(2)SE10a, RELEASE SOFTWARE (fc3)",
+			want: map[string]string{
+				"vendor":  "CISCO",
+				"os":      "IOS",
+				"model":   "C2960S",
+				"version": "C2960S-UNIVERSALK9-M Version 15.0(2)SE10a RELEASE SOFTWARE (fc3)",
+			},
+		},
+		{
+			name:     "enterprise os",
+			objectID: ".1.3.6.1.4.1.25506.11.1.83",
+			descr:    "HP Comware Platform Software, Software Version 5.20.99, Release 2221P05\nHP A5500-48G EI Switch with 2 Interface Slots",
+			want: map[string]string{
+				"vendor":  "HP",
+				"os":      "Comware",
+				"model":   "HP A5500-48G EI Switch with",
+				"version": "Software Version 5.20.99, Release 2221",
+			},
+		},
+		{
+			name:     "other vendor",
+			objectID: ".1.3.6.1.4.1.2636.1.1.1.2.29",
+			descr:    "Juniper Networks, Inc. mx240 internet router, kernel JUNOS 15.1R7.9, Build date: 2018-07-19 by builder, HPC",
+			want:     map[string]string{"vendor": "JUNIPER", "os": "JUNOS"},
+		},
+		{
+			name:  "no object id",
+			descr: "ProCurve J9145A 2910al-24G Switch, revision W.14.03, ROM W.14.04 (/sw/code/build/sbm(t4a_RC3))",
+			want: map[string]string{
+				"vendor":  "HP",
+				"os":      "ProCurve",
+				"model":   "ProCurve J9145A 2910al-24G Switch,",
+				"version": "revision W.14.03, ROM W.14.04",
+			},
+		},
+		{
+			name:     "unknown object id",
+			objectID: ".1.3.6.1.4.1.789.2.5",
+			descr:    "NetApp Release RironcityN_080806_2230: Wed Aug 6 23:55:19 PDT 2008",
+			want:     map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := identify(test.objectID, test.descr)
+			for _, k := range []string{"vendor", "os", "model", "version"} {
+				if got[k] != test.want[k] {
+					t.Errorf("want %s %q, got %q", k, test.want[k], got[k])
+				}
+			}
+		})
+	}
+}
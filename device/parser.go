@@ -0,0 +1,301 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Info is what a Parser identifies about a device.
+type Info struct {
+	Vendor  string // vendor of the device, i.e. "CISCO"
+	OS      string // operating system of the device, i.e. "IOS XE"
+	Model   string // model of the device
+	Version string // software version of the device
+}
+
+// Parser identifies devices by their sysObjectID and sysDescr. Parse returns
+// what it identifies about a device, and whether it identified the device.
+// Either value may be empty, i.e. when a device is identified through its
+// SSH connection there is no sysObjectID and the sysDescr is the header of
+// its `show version` output.
+type Parser interface {
+	Parse(objectID, descr string) (Info, bool)
+}
+
+// ParserFunc is a function that is a Parser.
+type ParserFunc func(objectID, descr string) (Info, bool)
+
+// Parse calls f(objectID, descr).
+func (f ParserFunc) Parse(objectID, descr string) (Info, bool) {
+	return f(objectID, descr)
+}
+
+type namedParser struct {
+	name string
+	Parser
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   []namedParser
+)
+
+func init() {
+	RegisterParser("hp", ParserFunc(parseHP))
+	RegisterParser("cisco", ParserFunc(parseCisco))
+	RegisterParser("objectid", ParserFunc(parseObjectID))
+}
+
+// RegisterParser registers a parser by name, replacing the parser registered
+// before by the same name. Parsers are tried from the most recently
+// registered, and each one that identifies a device fills in the fields left
+// empty by the ones before it, if it agrees on the vendor. The built-in
+// parsers are "objectid", which uses the sysObjectID table, then "cisco" and
+// "hp", which parse the sysDescr.
+func RegisterParser(name string, p Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	for i, np := range parsers {
+		if np.name == name {
+			parsers = append(parsers[:i], parsers[i+1:]...)
+			break
+		}
+	}
+	parsers = append(parsers, namedParser{name, p})
+}
+
+// UnregisterParser removes the parser registered by name, if any.
+func UnregisterParser(name string) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	for i, np := range parsers {
+		if np.name == name {
+			parsers = append(parsers[:i], parsers[i+1:]...)
+			return
+		}
+	}
+}
+
+// identify identifies a device by its sysObjectID and sysDescr with the
+// registered parsers.
+func identify(objectID, descr string) map[string]string {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	var info Info
+	for i := len(parsers) - 1; i >= 0; i-- {
+		v, ok := parsers[i].Parse(objectID, descr)
+		if !ok || info.Vendor != "" && !strings.EqualFold(v.Vendor, info.Vendor) {
+			continue
+		}
+		if info.Vendor == "" {
+			info.Vendor = v.Vendor
+		}
+		if info.OS == "" {
+			info.OS = v.OS
+		}
+		if info.Model == "" {
+			info.Model = v.Model
+		}
+		if info.Version == "" {
+			info.Version = v.Version
+		}
+	}
+	return map[string]string{
+		"addr":     "",
+		"hostname": "",
+		"vendor":   info.Vendor,
+		"os":       info.OS,
+		"model":    info.Model,
+		"version":  info.Version,
+	}
+}
+
+// parseSysDescr parses the sysDescr.0 OID string to gather device information.
+func parseSysDescr(sysDescr string) map[string]string {
+	return identify("", sysDescr)
+}
+
+const (
+	// Cisco IOS, IOS XE, IOS XR, and NX-OS regexp strings
+	ciscoModel    = `(([CATcat]{1,3}|[Nn]|[Mm]|[CGRcgr]{3})(\d{4}\w?|\d\w_\w*)|\w?\d*_rp)`
+	ciscoSoftware = ciscoModel + `(-(\w*[Kk]9|Y|I)([-_]([WANwan-]*)?[Mm][Zz]?)?)`
+	ciscoVersion  = `(Version (\(?(\d{1,2}|\w{1,2})\)?\.?)*)([[(].*[])])?(,?\s?)(RELEASE SOFTWARE (\(.*\)))?`
+
+	// HPE Comware and Procurve
+	hpeModel        = `(HP|HPE|ProCurve).*Switch\s?\w*,?`
+	comwareVersion  = `Software\sVersion\s(\d{1,3}\.?)*,?\s?Release\s\d{4}`
+	procurveVersion = `revision [A-Z]{1,2}(\.[0-9]{2,4})*,?\s?ROM [A-Z]{1,2}(\.[0-9]{2,4})*`
+)
+
+var (
+	// Cisco
+	modelCisco    = regexp.MustCompile(ciscoModel)
+	softwareCisco = regexp.MustCompile(ciscoSoftware)
+	versionCisco  = regexp.MustCompile(ciscoVersion)
+
+	// Hewlett Packard
+	modelHPE        = regexp.MustCompile(hpeModel)
+	versionComware  = regexp.MustCompile(comwareVersion)
+	versionProCurve = regexp.MustCompile(procurveVersion)
+)
+
+// parseCisco parses the sysDescr of Cisco IOS, IOS XE, IOS XR and NX-OS
+// devices.
+func parseCisco(_, sysDescr string) (Info, bool) {
+	if !strings.Contains(sysDescr, "Cisco") {
+		return Info{}, false
+	}
+	info := Info{Vendor: "CISCO", Model: modelCisco.FindString(sysDescr)}
+	software := softwareCisco.FindString(sysDescr)
+	version := versionCisco.FindString(sysDescr)
+	v := strings.Replace(version, ",", "", 5)
+	info.Version = strings.TrimSpace(fmt.Sprintf("%s %s", software, v))
+	switch {
+	case strings.Contains(sysDescr, "IOS"):
+		switch {
+		case strings.Contains(sysDescr, "IOS XR"), strings.Contains(sysDescr, "IOS-XR"):
+			info.OS = "IOS XR"
+		case strings.Contains(sysDescr, "IOS XE"), strings.Contains(sysDescr, "IOS-XE"):
+			info.OS = "IOS XE"
+		default:
+			info.OS = "IOS"
+		}
+	case strings.Contains(sysDescr, "NX OS"), strings.Contains(sysDescr, "NX-OS"):
+		info.OS = "NX-OS"
+	}
+	return info, true
+}
+
+// parseHP parses the sysDescr of HP Comware and ProCurve devices.
+func parseHP(_, sysDescr string) (Info, bool) {
+	if !strings.Contains(sysDescr, "Hewlett Packard") &&
+		!strings.Contains(sysDescr, "HP") &&
+		!strings.Contains(sysDescr, "ProCurve") {
+		return Info{}, false
+	}
+	info := Info{Vendor: "HP", Model: modelHPE.FindString(sysDescr)}
+	switch {
+	case strings.Contains(sysDescr, "Comware"):
+		info.OS = "Comware"
+		info.Version = versionComware.FindString(sysDescr)
+	case strings.Contains(sysDescr, "ProCurve"):
+		info.OS = "ProCurve"
+		info.Version = versionProCurve.FindString(sysDescr)
+	}
+	return info, true
+}
+
+// rule is a rule of a YAML parser file.
+type rule struct {
+	ObjectID string `yaml:"sysobjectid"` // regexp matching the sysObjectID, without its leading dot
+	Descr    string `yaml:"sysdescr"`    // regexp matching the sysDescr
+	Vendor   string `yaml:"vendor"`      // vendor of matching devices
+	OS       string `yaml:"os"`          // operating system of matching devices
+	Model    string `yaml:"model"`       // model of matching devices
+	Version  string `yaml:"version"`     // software version of matching devices
+
+	objectID *regexp.Regexp
+	descr    *regexp.Regexp
+}
+
+// ruleParser is a Parser of rules, which are tried in order.
+type ruleParser []rule
+
+// ParseRules reads a YAML list of rules that identify devices whose
+// sysObjectID and sysDescr match regular expressions:
+//
+//	# parsers.yml
+//	- sysobjectid: ^1\.3\.6\.1\.4\.1\.2636\.
+//	  sysdescr: '^Juniper Networks, Inc\. (?P<model>\S+) .*JUNOS (?P<version>[^,]+)'
+//	  vendor: JUNIPER
+//	  os: JUNOS
+//	  model: $model
+//	  version: $version
+//
+// A rule needs a vendor and at least one of sysobjectid and sysdescr, all of
+// which must match. The vendor, os, model and version may refer to the named
+// groups of the regular expressions as $name or ${name}. The first rule that
+// matches identifies a device.
+func ParseRules(r io.Reader) (Parser, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var rules ruleParser
+	if err := yaml.Unmarshal(b, &rules); err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		r := &rules[i]
+		if r.Vendor == "" {
+			return nil, fmt.Errorf("rule %d: no vendor", i+1)
+		}
+		if r.ObjectID == "" && r.Descr == "" {
+			return nil, fmt.Errorf("rule %d: no sysobjectid or sysdescr", i+1)
+		}
+		if r.ObjectID != "" {
+			if r.objectID, err = regexp.Compile(r.ObjectID); err != nil {
+				return nil, fmt.Errorf("rule %d: sysobjectid: %v", i+1, err)
+			}
+		}
+		if r.Descr != "" {
+			if r.descr, err = regexp.Compile(r.Descr); err != nil {
+				return nil, fmt.Errorf("rule %d: sysdescr: %v", i+1, err)
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("no rules")
+	}
+	return rules, nil
+}
+
+// Parse returns the device identified by the first matching rule.
+func (rules ruleParser) Parse(objectID, descr string) (Info, bool) {
+	objectID = strings.TrimPrefix(objectID, ".")
+	for _, r := range rules {
+		groups := make(map[string]string)
+		if !match(r.objectID, objectID, groups) || !match(r.descr, descr, groups) {
+			continue
+		}
+		expand := func(s string) string {
+			return strings.TrimSpace(os.Expand(s, func(name string) string { return groups[name] }))
+		}
+		info := Info{
+			Vendor:  expand(r.Vendor),
+			OS:      expand(r.OS),
+			Model:   expand(r.Model),
+			Version: expand(r.Version),
+		}
+		if info.Vendor != "" {
+			return info, true
+		}
+	}
+	return Info{}, false
+}
+
+// match reports whether re, if any, matches s, and adds the named groups of
+// the match to groups.
+func match(re *regexp.Regexp, s string, groups map[string]string) bool {
+	if re == nil {
+		return true
+	}
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			groups[name] = m[i]
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package device
+
+import (
+	"strings"
+	"testing"
+)
+
+const juniperRules = `
+- sysobjectid: ^1\.3\.6\.1\.4\.1\.2636\.
+  sysdescr: '^Juniper Networks, Inc\. (?P<model>\S+) .*JUNOS (?P<version>[^,]+)'
+  vendor: JUNIPER
+  os: JUNOS
+  model: $model
+  version: ${version}
+- sysdescr: 'Cisco IOS Software, (?P<model>\S+) Software'
+  vendor: CISCO
+  model: Catalyst ${model}
+`
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		ok    bool
+	}{
+		{"rules", juniperRules, true},
+		{"no rules", "", false},
+		{"not a list", "vendor: JUNIPER", false},
+		{"no vendor", "- sysdescr: JUNOS", false},
+		{"no regexp", "- vendor: JUNIPER", false},
+		{"bad sysobjectid", "- {vendor: JUNIPER, sysobjectid: '1.3.6.1.4.1.(2636'}", false},
+		{"bad sysdescr", "- {vendor: JUNIPER, sysdescr: 'JUNOS ['}", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseRules(strings.NewReader(test.rules))
+			if (err == nil) != test.ok {
+				t.Errorf("want ok %t, got %v", test.ok, err)
+			}
+		})
+	}
+}
+
+func TestRuleParser_Parse(t *testing.T) {
+	p, err := ParseRules(strings.NewReader(juniperRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		objectID string
+		descr    string
+		ok       bool
+		want     Info
+	}{
+		{
+			name:     "named groups",
+			objectID: ".1.3.6.1.4.1.2636.1.1.1.2.29",
+			descr:    "Juniper Networks, Inc. mx240 internet router, kernel JUNOS 15.1R7.9, Build date: 2018-07-19",
+			ok:       true,
+			want:     Info{Vendor: "JUNIPER", OS: "JUNOS", Model: "mx240", Version: "15.1R7.9"},
+		},
+		{
+			name:     "sysobjectid mismatch",
+			objectID: ".1.3.6.1.4.1.9.1.1208",
+			descr:    "Juniper Networks, Inc. mx240 internet router, kernel JUNOS 15.1R7.9, Build date: 2018-07-19",
+			ok:       false,
+		},
+		{
+			name:  "sysdescr only",
+			descr: "Cisco IOS Software, C2960S Software (C2960S-UNIVERSALK9-M), Version 15.0(2)SE10a",
+			ok:    true,
+			want:  Info{Vendor: "CISCO", Model: "Catalyst C2960S"},
+		},
+		{
+			name:  "no match",
+			descr: "NetApp Release RironcityN_080806_2230",
+			ok:    false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := p.Parse(test.objectID, test.descr)
+			if ok != test.ok || got != test.want {
+				t.Errorf("want %+v (%t), got %+v (%t)", test.want, test.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestRegisterParser(t *testing.T) {
+	defer func(p []namedParser) { parsers = p }(append([]namedParser(nil), parsers...))
+
+	rules, err := ParseRules(strings.NewReader(juniperRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterParser("rules", rules)
+	RegisterParser("rules", rules)
+	if len(parsers) != 4 {
+		t.Fatalf("want 4 parsers, got %d", len(parsers))
+	}
+
+	tests := []struct {
+		name     string
+		objectID string
+		descr    string
+		want     map[string]string
+	}{
+		{
+			name:     "registered parser",
+			objectID: ".1.3.6.1.4.1.2636.1.1.1.2.29",
+			descr:    "Juniper Networks, Inc. mx240 internet router, kernel JUNOS 15.1R7.9, Build date: 2018-07-19",
+			want:     map[string]string{"vendor": "JUNIPER", "os": "JUNOS", "model": "mx240", "version": "15.1R7.9"},
+		},
+		{
+			name:     "built-in parsers fill in",
+			objectID: ".1.3.6.1.4.1.9.1.1208",
+			descr:    "Cisco IOS Software, C2960S Software (C2960S-UNIVERSALK9-M), Version 15.0(2)SE10a, RELEASE SOFTWARE (fc3)",
+			want: map[string]string{
+				"vendor":  "CISCO",
+				"os":      "IOS",
+				"model":   "Catalyst C2960S",
+				"version": "C2960S-UNIVERSALK9-M Version 15.0(2)SE10a RELEASE SOFTWARE (fc3)",
+			},
+		},
+		{
+			name:  "built-in parsers",
+			descr: "ProCurve J9145A 2910al-24G Switch, revision W.14.03, ROM W.14.04 (/sw/code/build/sbm(t4a_RC3))",
+			want: map[string]string{
+				"vendor":  "HP",
+				"os":      "ProCurve",
+				"model":   "ProCurve J9145A 2910al-24G Switch,",
+				"version": "revision W.14.03, ROM W.14.04",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := identify(test.objectID, test.descr)
+			for _, k := range []string{"vendor", "os", "model", "version"} {
+				if got[k] != test.want[k] {
+					t.Errorf("want %s %q, got %q", k, test.want[k], got[k])
+				}
+			}
+		})
+	}
+
+	UnregisterParser("rules")
+	UnregisterParser("rules")
+	if len(parsers) != 3 {
+		t.Errorf("want 3 parsers, got %d", len(parsers))
+	}
+}
@@ -0,0 +1,156 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// banners map the software names in SSH server version banners, such as
+// "SSH-2.0-Cisco-1.25", to the vendor and OS of the device.
+var banners = []struct {
+	software *regexp.Regexp
+	vendor   string
+	os       string
+}{
+	{regexp.MustCompile(`^Cisco-`), "CISCO", ""},
+	{regexp.MustCompile(`^Comware-`), "HP", "Comware"},
+	{regexp.MustCompile(`^HUAWEI-`), "HUAWEI", "VRP"},
+	{regexp.MustCompile(`^ROSSSH`), "MIKROTIK", "RouterOS"},
+}
+
+// probes are the commands run to show the version of the devices of each
+// vendor, in the order they are tried. Devices of an unknown vendor are
+// tried with every command.
+var probes = map[string][]string{
+	"CISCO": {"show version"},
+	"HP":    {"display version", "show version"},
+	"":      {"show version", "display version"},
+}
+
+var (
+	// versionHeader matches the line of `show version` or `display version`
+	// output that shows the software version, like a sysDescr.
+	versionHeader = regexp.MustCompile(`(?m)^.*(?:Cisco|Comware).*$`)
+
+	// ciscoChassis matches the model in `show version` output, i.e. "cisco
+	// WS-C2960S-48FPD-L (PowerPC405) processor" or "cisco Nexus9000
+	// C93180YC-EX chassis".
+	ciscoChassis = regexp.MustCompile(`(?m)^\s*cisco (.+?) (?:\(.*\) processor|chassis)`)
+
+	// nxosVersion matches the version in NX-OS `show version` output, i.e.
+	// "NXOS: version 9.3(5)" or "system:    version 7.0(3)I7(6)".
+	nxosVersion = regexp.MustCompile(`(?m)^\s*(?:NXOS|system):\s+(version \S+)`)
+
+	// comwareVersionOutput matches the version in `display version` output,
+	// i.e. "Comware Software, Version 7.1.070, Release 3208P03".
+	comwareVersionOutput = regexp.MustCompile(`Comware Software, (Version [\d.]+, Release \w+)`)
+
+	// comwareModelOutput matches the model in `display version` output, i.e.
+	// "HPE 5130 24G 4SFP+ EI Switch uptime is 1 week".
+	comwareModelOutput = regexp.MustCompile(`(?m)^((?:HPE?|H3C) .+?) uptime is`)
+
+	// procurveImage matches the version in ProCurve `show version` output,
+	// which follows the image stamp, i.e. "W.15.14.0012".
+	procurveImage = regexp.MustCompile(`Image stamp:.*\n.*\n\s*([A-Z]{1,2}\.\d{2}\.\d{2}\.\d{4})`)
+)
+
+// sshFacts identifies a device through its SSH connection, by the version
+// banner of its SSH server and the output of a command that shows its
+// version. Neither is run in privileged mode.
+func (c *Client) sshFacts() (map[string]string, error) {
+	m := parseSysDescr("")
+	m["vendor"], m["os"] = parseBanner(string(c.client.ServerVersion()))
+
+	// the session uses the prompt and paging commands of the vendor, if known
+	c.vendor, c.os = m["vendor"], m["os"]
+	var errs []string
+	for _, cmd := range probes[m["vendor"]] {
+		out, err := c.probe(cmd)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", cmd, err))
+			continue
+		}
+		v := parseVersion(out)
+		if v["vendor"] == "" {
+			errs = append(errs, fmt.Sprintf("%s: unknown device", cmd))
+			continue
+		}
+		if v["os"] == "" && v["vendor"] == m["vendor"] {
+			v["os"] = m["os"]
+		}
+		return v, nil
+	}
+	if m["vendor"] != "" {
+		return m, nil
+	}
+	return nil, errors.New(strings.Join(errs, "; "))
+}
+
+// probe runs a command on the device, with paging disabled, and returns its
+// output. The session is left for the commands run after the device is
+// identified.
+func (c *Client) probe(cmd string) (string, error) {
+	s, err := c.session(false)
+	if err != nil {
+		return "", err
+	}
+	if s.login {
+		return "", errors.New("device asks for a login")
+	}
+
+	for _, paging := range s.driver.Paging {
+		s.Run(paging)
+	}
+	out := s.Run(cmd)
+	if out.Err != nil {
+		return "", out.Err
+	}
+	return string(out.Out), nil
+}
+
+// parseBanner returns the vendor and OS of a device from the version banner
+// of its SSH server, if the banner names them.
+func parseBanner(banner string) (vendor, os string) {
+	// SSH-protoversion-softwareversion SP comments
+	parts := strings.SplitN(banner, "-", 3)
+	if len(parts) != 3 {
+		return "", ""
+	}
+	for _, b := range banners {
+		if b.software.MatchString(parts[2]) {
+			return b.vendor, b.os
+		}
+	}
+	return "", ""
+}
+
+// parseVersion parses the output of `show version` or `display version` to
+// gather device information like parseSysDescr.
+func parseVersion(out string) map[string]string {
+	if v := procurveImage.FindStringSubmatch(out); v != nil {
+		m := parseSysDescr("")
+		m["vendor"], m["os"], m["version"] = "HP", "ProCurve", v[1]
+		return m
+	}
+
+	m := parseSysDescr(versionHeader.FindString(out))
+	switch {
+	case m["vendor"] == "CISCO":
+		if v := ciscoChassis.FindStringSubmatch(out); v != nil && m["model"] == "" {
+			m["model"] = v[1]
+		}
+		if v := nxosVersion.FindStringSubmatch(out); v != nil && m["version"] == "" {
+			m["version"] = v[1]
+		}
+	case m["os"] == "Comware":
+		if v := comwareModelOutput.FindStringSubmatch(out); v != nil {
+			m["model"] = v[1]
+		}
+		if v := comwareVersionOutput.FindStringSubmatch(out); v != nil {
+			m["version"] = v[1]
+		}
+	}
+	return m
+}
@@ -0,0 +1,191 @@
+package device
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	iosVersion = `Cisco IOS Software, C2960S Software (C2960S-UNIVERSALK9-M), Version 15.0(2)SE10a, RELEASE SOFTWARE (fc3)
+Technical Support: http://www.cisco.com/techsupport
+Copyright (c) 1986-2016 by Cisco Systems, Inc.
+Compiled Thu 03-Nov-16 13:52 by prod_rel_team
+
+ROM: Bootstrap program is C2960S boot loader
+BOOTLDR: C2960S Boot Loader (C2960S-HBOOT-M) Version 12.2(55r)SE, RELEASE SOFTWARE (fc1)
+
+switch-1 uptime is 1 year, 2 weeks, 3 days, 4 hours, 5 minutes
+System returned to ROM by power-on
+System image file is "flash:c2960s-universalk9-mz.150-2.SE10a.bin"
+
+cisco WS-C2960S-48FPD-L (PowerPC405) processor (revision A0) with 131072K bytes of memory.`
+
+	nxosVersionOutput = `Cisco Nexus Operating System (NX-OS) Software
+TAC support: http://www.cisco.com/tac
+Copyright (C) 2002-2020, Cisco and/or its affiliates.
+
+Software
+  BIOS: version 07.68
+  NXOS: version 9.3(5)
+  BIOS compile time:  03/09/2020
+
+Hardware
+  cisco Nexus9000 C93180YC-EX chassis
+  Intel(R) Xeon(R) CPU  @ 1.80GHz with 24632956 kB of memory.`
+
+	comwareVersion7 = `HPE Comware Software, Version 7.1.070, Release 3208P03
+Copyright (c) 2010-2019 Hewlett Packard Enterprise Development LP
+HPE 5130 24G 4SFP+ EI Switch uptime is 0 weeks, 1 day, 2 hours, 3 minutes
+Last reboot reason : User reboot`
+
+	procurveVersionOutput = `Image stamp:    /ws/swbuildm/rel_yakima_qaoff/code/build/btm(swbuildm_rel_yakima_qaoff_rel_yakima)
+                Jun 10 2013 16:01:13
+                W.15.14.0012
+                1223
+Boot Image:     Primary`
+)
+
+func TestParseBanner(t *testing.T) {
+	tests := []struct {
+		banner string
+		vendor string
+		os     string
+	}{
+		{"SSH-2.0-Cisco-1.25", "CISCO", ""},
+		{"SSH-1.99-Comware-7.1.064", "HP", "Comware"},
+		{"SSH-2.0-HUAWEI-1.5", "HUAWEI", "VRP"},
+		{"SSH-2.0-ROSSSH", "MIKROTIK", "RouterOS"},
+		{"SSH-2.0-OpenSSH_7.4 Cisco", "", ""},
+		{"SSH-2.0-Go", "", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		vendor, os := parseBanner(test.banner)
+		if vendor != test.vendor || os != test.os {
+			t.Errorf("%q: want %q %q, got %q %q", test.banner, test.vendor, test.os, vendor, os)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want map[string]string
+	}{
+		{"cisco IOS", iosVersion, map[string]string{
+			"vendor":  "CISCO",
+			"os":      "IOS",
+			"model":   "C2960S",
+			"version": "C2960S-UNIVERSALK9-M Version 15.0(2)SE10a RELEASE SOFTWARE (fc3)",
+		}},
+		{"cisco NX-OS", nxosVersionOutput, map[string]string{
+			"vendor":  "CISCO",
+			"os":      "NX-OS",
+			"model":   "Nexus9000 C93180YC-EX",
+			"version": "version 9.3(5)",
+		}},
+		{"HP Comware", comwareVersion7, map[string]string{
+			"vendor":  "HP",
+			"os":      "Comware",
+			"model":   "HPE 5130 24G 4SFP+ EI Switch",
+			"version": "Version 7.1.070, Release 3208P03",
+		}},
+		{"HP ProCurve", procurveVersionOutput, map[string]string{
+			"vendor":  "HP",
+			"os":      "ProCurve",
+			"version": "W.15.14.0012",
+		}},
+		{"unknown", "JUNOS Software Release [15.1R7.9]", map[string]string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseVersion(test.out)
+			for _, k := range []string{"vendor", "os", "model", "version"} {
+				if got[k] != test.want[k] {
+					t.Errorf("want %s %q, got %q", k, test.want[k], got[k])
+				}
+			}
+		})
+	}
+}
+
+func TestClient_SSHFacts(t *testing.T) {
+	crlf := func(s string) string { return strings.Replace(s, "\n", "\r\n", -1) + "\r\n" }
+	tests := []struct {
+		name      string
+		prompt    string
+		responses map[string]response
+		ok        bool
+		want      map[string]string
+	}{
+		{
+			name:      "show version",
+			prompt:    "switch-1>",
+			responses: map[string]response{"show version": {out: crlf(iosVersion)}},
+			ok:        true,
+			want:      map[string]string{"vendor": "CISCO", "os": "IOS", "model": "C2960S"},
+		},
+		{
+			name:      "display version",
+			prompt:    "<HPE>",
+			responses: map[string]response{"display version": {out: crlf(comwareVersion7)}},
+			ok:        true,
+			want:      map[string]string{"vendor": "HP", "os": "Comware", "model": "HPE 5130 24G 4SFP+ EI Switch"},
+		},
+		{
+			name:   "unknown",
+			prompt: "router>",
+			ok:     false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := serveCLI(t, "", test.prompt, test.responses)
+			got, err := c.sshFacts()
+			if (err == nil) != test.ok {
+				t.Fatalf("want ok %t, got %v", test.ok, err)
+			}
+			for k, v := range test.want {
+				if got[k] != v {
+					t.Errorf("want %s %q, got %q", k, v, got[k])
+				}
+			}
+		})
+	}
+}
+
+func TestClient_Discover(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]response
+		vendor    string
+		warning   string
+	}{
+		{
+			name:      "ssh",
+			responses: map[string]response{"show version": {out: strings.Replace(iosVersion, "\n", "\r\n", -1) + "\r\n"}},
+			vendor:    "CISCO",
+			warning:   "identified the device through ssh",
+		},
+		{
+			name:    "unknown",
+			warning: "could not identify the device",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := serveCLI(t, "", "switch-1>", test.responses)
+			c.addr = "127.0.0.1"
+			// no SNMP agent listens on the port
+			c.discover(SNMP{Community: "public", Timeout: 100 * time.Millisecond})
+			if c.Vendor() != test.vendor {
+				t.Errorf("want vendor %q, got %q", test.vendor, c.Vendor())
+			}
+			if w := c.Warnings(); len(w) != 1 || !strings.Contains(w[0].Error(), test.warning) {
+				t.Errorf("want a warning containing %q, got %v", test.warning, w)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultSNMPPort is the port of the SNMP agent of a device when the
+	// SNMP settings do not set one.
+	DefaultSNMPPort = 161
+
+	// DefaultSNMPTimeout is the time to wait for an SNMP response when the
+	// SNMP settings do not set one.
+	DefaultSNMPTimeout = 5 * time.Second
+)
+
+// SNMP are the settings used to discover devices with SNMP, read from the
+// `snmp` section of the global config.
+type SNMP struct {
+	Version        string        `mapstructure:"version"`         // SNMP version, "2c" or "3", 2c if empty
+	Community      string        `mapstructure:"community"`       // community string for version 2c
+	User           string        `mapstructure:"user"`            // security name for version 3
+	AuthProtocol   string        `mapstructure:"auth_protocol"`   // authentication protocol, "MD5", "SHA" or "SHA-256", if any
+	AuthPassphrase string        `mapstructure:"auth_passphrase"` // authentication passphrase
+	PrivProtocol   string        `mapstructure:"priv_protocol"`   // privacy protocol, "DES" or "AES", if any
+	PrivPassphrase string        `mapstructure:"priv_passphrase"` // privacy passphrase
+	Context        string        `mapstructure:"context"`         // context name for version 3
+	Port           int           `mapstructure:"port"`            // port of the SNMP agent, DefaultSNMPPort if zero
+	Retries        int           `mapstructure:"retries"`         // number of times to retry a request that times out
+	Timeout        time.Duration `mapstructure:"timeout"`         // time to wait for a response, DefaultSNMPTimeout if zero
+}
+
+// authProtocols are the SNMPv3 authentication protocols by name.
+var authProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"":        gosnmp.NoAuth,
+	"MD5":     gosnmp.MD5,
+	"SHA":     gosnmp.SHA,
+	"SHA-256": gosnmp.SHA256,
+	"SHA256":  gosnmp.SHA256,
+}
+
+// privProtocols are the SNMPv3 privacy protocols by name.
+var privProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"":    gosnmp.NoPriv,
+	"DES": gosnmp.DES,
+	"AES": gosnmp.AES,
+}
+
+// SNMPSettings reads the SNMP settings from the global config. The community
+// may also be set with a flag bound to `snmp.community`.
+func SNMPSettings() (SNMP, error) {
+	var s SNMP
+	if err := viper.UnmarshalKey("snmp", &s); err != nil {
+		return s, fmt.Errorf("invalid snmp settings: %v", err)
+	}
+	s.Community = viper.GetString("snmp.community")
+	return s, nil
+}
+
+// client returns an SNMP client for a host with the settings, which is not
+// yet connected.
+func (s SNMP) client(addr string) (*gosnmp.GoSNMP, error) {
+	if s.Port < 0 || s.Port > 65535 {
+		return nil, fmt.Errorf("invalid snmp port %d", s.Port)
+	}
+	if s.Retries < 0 {
+		return nil, fmt.Errorf("invalid snmp retries %d", s.Retries)
+	}
+	c := &gosnmp.GoSNMP{
+		Target:  addr,
+		Port:    DefaultSNMPPort,
+		Timeout: DefaultSNMPTimeout,
+		Retries: s.Retries,
+		MaxOids: gosnmp.MaxOids,
+	}
+	if s.Port != 0 {
+		c.Port = uint16(s.Port)
+	}
+	if s.Timeout > 0 {
+		c.Timeout = s.Timeout
+	}
+	switch s.Version {
+	case "", "2c", "2":
+		c.Version = gosnmp.Version2c
+		c.Community = s.Community
+		return c, nil
+	case "3":
+	default:
+		return nil, fmt.Errorf("unsupported snmp version %q", s.Version)
+	}
+
+	auth, ok := authProtocols[strings.ToUpper(s.AuthProtocol)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported snmp auth_protocol %q", s.AuthProtocol)
+	}
+	priv, ok := privProtocols[strings.ToUpper(s.PrivProtocol)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported snmp priv_protocol %q", s.PrivProtocol)
+	}
+	if s.User == "" {
+		return nil, errors.New("snmp version 3 requires a user")
+	}
+	switch {
+	case priv != gosnmp.NoPriv && auth == gosnmp.NoAuth:
+		return nil, errors.New("snmp priv_protocol requires an auth_protocol")
+	case auth != gosnmp.NoAuth && s.AuthPassphrase == "":
+		return nil, errors.New("snmp auth_protocol requires an auth_passphrase")
+	case priv != gosnmp.NoPriv && s.PrivPassphrase == "":
+		return nil, errors.New("snmp priv_protocol requires a priv_passphrase")
+	}
+
+	c.Version = gosnmp.Version3
+	c.SecurityModel = gosnmp.UserSecurityModel
+	c.ContextName = s.Context
+	switch {
+	case priv != gosnmp.NoPriv:
+		c.MsgFlags = gosnmp.AuthPriv
+	case auth != gosnmp.NoAuth:
+		c.MsgFlags = gosnmp.AuthNoPriv
+	default:
+		c.MsgFlags = gosnmp.NoAuthNoPriv
+	}
+	c.SecurityParameters = &gosnmp.UsmSecurityParameters{
+		UserName:                 s.User,
+		AuthenticationProtocol:   auth,
+		AuthenticationPassphrase: s.AuthPassphrase,
+		PrivacyProtocol:          priv,
+		PrivacyPassphrase:        s.PrivPassphrase,
+	}
+	return c, nil
+}
+
+const (
+	sysDescrOID    = ".1.3.6.1.2.1.1.1.0" // description of a device
+	sysObjectIDOID = ".1.3.6.1.2.1.1.2.0" // OID identifying the vendor and model of a device
+)
+
+// snmpFacts gets the sysObjectID and sysDescr of a host through SNMP and
+// identifies the device by them.
+func snmpFacts(addr string, s SNMP) (map[string]string, error) {
+	values, err := s.get(addr, sysObjectIDOID, sysDescrOID)
+	if err != nil {
+		return nil, err
+	}
+	if values[0] == "" && values[1] == "" {
+		return nil, errors.New("no sysObjectID or sysDescr")
+	}
+	return identify(values[0], values[1]), nil
+}
+
+// get gets the values of objects of a host through SNMP as strings. The value
+// of an object that does not exist is empty.
+func (s SNMP) get(addr string, oids ...string) ([]string, error) {
+	client, err := s.client(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	defer client.Conn.Close()
+
+	res, err := client.Get(oids)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != gosnmp.NoError {
+		return nil, fmt.Errorf("agent returned %v", res.Error)
+	}
+	values := make([]string, len(oids))
+	for i, v := range res.Variables {
+		if i >= len(values) {
+			break
+		}
+		switch v.Type {
+		case gosnmp.OctetString:
+			if b, ok := v.Value.([]byte); ok {
+				values[i] = string(b)
+			}
+		case gosnmp.ObjectIdentifier:
+			if oid, ok := v.Value.(string); ok {
+				values[i] = oid
+			}
+		}
+	}
+	return values, nil
+}
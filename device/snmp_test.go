@@ -0,0 +1,195 @@
+package device
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/spf13/viper"
+)
+
+const engineID = "\x80\x00\x1f\x88\x80netcfg-test"
+
+// serveSNMP starts a stand-in SNMP agent on a local UDP port that answers
+// gets of sysObjectID and sysDescr with objectID and descr, using the SNMP
+// settings a client must have, and returns the port it listens on. An empty
+// objectID does not exist on the agent.
+func serveSNMP(t *testing.T, s SNMP, objectID, descr string) uint16 {
+	agent, err := s.client("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req, err := agent.SnmpDecodePacket(buf[:n])
+			if err != nil || req.PDUType != gosnmp.GetRequest {
+				continue
+			}
+			var resp []byte
+			switch {
+			case req.Version == gosnmp.Version2c && req.Community != s.Community:
+				continue
+			case req.Version == gosnmp.Version3 && len(req.Variables) == 0:
+				// engine discovery, answered with a report of the engine ID
+				report := &gosnmp.SnmpPacket{
+					Version:       gosnmp.Version3,
+					MsgFlags:      gosnmp.NoAuthNoPriv,
+					SecurityModel: gosnmp.UserSecurityModel,
+					SecurityParameters: &gosnmp.UsmSecurityParameters{
+						AuthoritativeEngineID:    engineID,
+						AuthoritativeEngineBoots: 1,
+						AuthoritativeEngineTime:  1,
+					},
+					ContextEngineID: engineID,
+					PDUType:         gosnmp.Report,
+					MsgID:           req.MsgID,
+					RequestID:       req.RequestID,
+					Variables: []gosnmp.SnmpPDU{
+						{Name: ".1.3.6.1.6.3.15.1.1.4.0", Type: gosnmp.Counter32, Value: uint32(1)},
+					},
+				}
+				if resp, err = report.MarshalMsg(); err != nil {
+					t.Error(err)
+					return
+				}
+			default:
+				// the request holds the keys localized to the engine ID
+				agent.SecurityParameters = req.SecurityParameters
+				agent.SetRequestID(req.RequestID - 1)
+				agent.SetMsgID(req.MsgID - 1)
+				agent.ContextEngineID = engineID
+				var pdus []gosnmp.SnmpPDU
+				for _, v := range req.Variables {
+					pdu := gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.NoSuchObject}
+					switch {
+					case v.Name == sysDescrOID:
+						pdu.Type, pdu.Value = gosnmp.OctetString, descr
+					case v.Name == sysObjectIDOID && objectID != "":
+						pdu.Type, pdu.Value = gosnmp.ObjectIdentifier, objectID
+					}
+					pdus = append(pdus, pdu)
+				}
+				if resp, err = agent.SnmpEncodePacket(gosnmp.GetResponse, pdus, 0, 0); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func TestSNMPSettings(t *testing.T) {
+	defer viper.Set("snmp", nil)
+	viper.Set("snmp", map[string]interface{}{
+		"version":         "3",
+		"user":            "netcfg",
+		"auth_protocol":   "SHA",
+		"auth_passphrase": "authpass",
+		"port":            1161,
+		"retries":         2,
+		"timeout":         "2s",
+	})
+	got, err := SNMPSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SNMP{Version: "3", User: "netcfg", AuthProtocol: "SHA", AuthPassphrase: "authpass", Port: 1161, Retries: 2, Timeout: 2 * time.Second}
+	if got != want {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestSNMP_Client(t *testing.T) {
+	tests := []struct {
+		snmp    SNMP
+		version gosnmp.SnmpVersion
+		flags   gosnmp.SnmpV3MsgFlags
+		ok      bool
+	}{
+		{SNMP{Community: "public"}, gosnmp.Version2c, 0, true},
+		{SNMP{Version: "2c", Community: "public"}, gosnmp.Version2c, 0, true},
+		{SNMP{Version: "1"}, 0, 0, false},
+		{SNMP{Community: "public", Port: 1161, Retries: 3, Timeout: time.Second}, gosnmp.Version2c, 0, true},
+		{SNMP{Community: "public", Port: 65536}, 0, 0, false},
+		{SNMP{Community: "public", Retries: -1}, 0, 0, false},
+		{SNMP{Version: "3", User: "netcfg"}, gosnmp.Version3, gosnmp.NoAuthNoPriv, true},
+		{SNMP{Version: "3", User: "netcfg", AuthProtocol: "sha-256", AuthPassphrase: "authpass"}, gosnmp.Version3, gosnmp.AuthNoPriv, true},
+		{SNMP{Version: "3", User: "netcfg", AuthProtocol: "MD5", AuthPassphrase: "authpass", PrivProtocol: "DES", PrivPassphrase: "privpass"}, gosnmp.Version3, gosnmp.AuthPriv, true},
+		{SNMP{Version: "3", User: "netcfg", AuthProtocol: "SHA", AuthPassphrase: "authpass", PrivProtocol: "aes", PrivPassphrase: "privpass"}, gosnmp.Version3, gosnmp.AuthPriv, true},
+		{SNMP{Version: "3"}, 0, 0, false},
+		{SNMP{Version: "3", User: "netcfg", AuthProtocol: "SHA-1", AuthPassphrase: "authpass"}, 0, 0, false},
+		{SNMP{Version: "3", User: "netcfg", AuthProtocol: "SHA"}, 0, 0, false},
+		{SNMP{Version: "3", User: "netcfg", PrivProtocol: "AES", PrivPassphrase: "privpass"}, 0, 0, false},
+		{SNMP{Version: "3", User: "netcfg", AuthProtocol: "SHA", AuthPassphrase: "authpass", PrivProtocol: "3DES", PrivPassphrase: "privpass"}, 0, 0, false},
+		{SNMP{Version: "3", User: "netcfg", AuthProtocol: "SHA", AuthPassphrase: "authpass", PrivProtocol: "AES"}, 0, 0, false},
+	}
+	for _, test := range tests {
+		c, err := test.snmp.client("10.0.0.1")
+		if gotOK := err == nil; gotOK != test.ok {
+			t.Errorf("%+v: want ok %t, got %v", test.snmp, test.ok, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if c.Version != test.version || c.MsgFlags != test.flags {
+			t.Errorf("%+v: want version %v and flags %v, got %v and %v", test.snmp, test.version, test.flags, c.Version, c.MsgFlags)
+		}
+	}
+}
+
+func TestSNMPFacts_Agent(t *testing.T) {
+	const descr = "Cisco IOS Software, C3750E Software (C3750E-UNIVERSALK9-M), Version 15.0(2)SE11, RELEASE SOFTWARE (fc3)"
+	tests := []SNMP{
+		{Community: "s3cret"},
+		{Version: "3", User: "netcfg"},
+		{Version: "3", User: "netcfg", AuthProtocol: "SHA-256", AuthPassphrase: "authpass1"},
+		{Version: "3", User: "netcfg", AuthProtocol: "MD5", AuthPassphrase: "authpass1", PrivProtocol: "DES", PrivPassphrase: "privpass1"},
+		{Version: "3", User: "netcfg", AuthProtocol: "SHA", AuthPassphrase: "authpass1", PrivProtocol: "AES", PrivPassphrase: "privpass1", Context: "vlan-10"},
+	}
+	for _, test := range tests {
+		test.Port = int(serveSNMP(t, test, "", descr))
+		m, err := snmpFacts("127.0.0.1", test)
+		if err != nil {
+			t.Errorf("%+v: %v", test, err)
+			continue
+		}
+		if m["vendor"] != "CISCO" || m["os"] != "IOS" {
+			t.Errorf("%+v: want Cisco IOS, got %v", test, m)
+		}
+	}
+
+	// the agent does not answer with the wrong community
+	s := SNMP{Community: "s3cret", Timeout: 100 * time.Millisecond}
+	s.Port = int(serveSNMP(t, s, "", descr))
+	s.Community = "public"
+	if m, err := snmpFacts("127.0.0.1", s); err == nil {
+		t.Errorf("want error with the wrong community, got %v", m)
+	}
+
+	// the sysObjectID identifies the model
+	s = SNMP{Community: "public"}
+	s.Port = int(serveSNMP(t, s, ".1.3.6.1.4.1.11.2.3.7.11.50", "ProCurve J8697A Switch 5406zl, revision K.15.18.0013, ROM K.15.30"))
+	m, err := snmpFacts("127.0.0.1", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["vendor"] != "HP" || m["os"] != "ProCurve" || m["model"] != "J8697A" || m["version"] != "revision K.15.18.0013, ROM K.15.30" {
+		t.Errorf("want HP ProCurve J8697A, got %v", m)
+	}
+}
@@ -0,0 +1,472 @@
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ansible is an Ansible inventory before group membership and variables are
+// resolved for each host.
+type ansible struct {
+	groups   map[string]*ansibleGroup     // groups by name
+	hostVars map[string]map[string]string // variables set on each host
+	order    []string                     // names of the hosts in the order first seen
+}
+
+// ansibleGroup is a group of hosts in an Ansible inventory.
+type ansibleGroup struct {
+	hosts    []string          // names of the hosts in the group
+	children []string          // names of the child groups
+	vars     map[string]string // variables for every host in the group
+}
+
+// newAnsible creates an empty Ansible inventory with the implicit groups "all"
+// and "ungrouped".
+func newAnsible() *ansible {
+	inv := &ansible{
+		groups:   make(map[string]*ansibleGroup),
+		hostVars: make(map[string]map[string]string),
+	}
+	inv.group("all")
+	inv.group("ungrouped")
+	return inv
+}
+
+// group returns the named group, creating it if it does not exist.
+func (inv *ansible) group(name string) *ansibleGroup {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &ansibleGroup{vars: make(map[string]string)}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+// addHost adds a host with its variables to a group.
+func (inv *ansible) addHost(group, name string, vars map[string]string) {
+	g := inv.group(group)
+	g.hosts = append(g.hosts, name)
+	hv, ok := inv.hostVars[name]
+	if !ok {
+		hv = make(map[string]string)
+		inv.hostVars[name] = hv
+		inv.order = append(inv.order, name)
+	}
+	for k, v := range vars {
+		hv[k] = v
+	}
+}
+
+// ParseAnsibleINI reads an Ansible inventory in INI format.
+func ParseAnsibleINI(r io.Reader) ([]Host, error) {
+	inv := newAnsible()
+	section, kind := "ungrouped", "hosts"
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section, kind = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"), "hosts"
+			if i := strings.LastIndex(section, ":"); i >= 0 {
+				section, kind = section[:i], section[i+1:]
+			}
+			if kind != "hosts" && kind != "vars" && kind != "children" {
+				return nil, fmt.Errorf("line %d: unknown section type %q", n, kind)
+			}
+			inv.group(section)
+			continue
+		}
+
+		fields, err := splitFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: missing host or group in %q", n, line)
+		}
+		switch kind {
+		case "hosts":
+			vars, err := parseVars(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			pattern := splitPort(fields[0], vars)
+			names, err := expandPattern(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			for _, name := range names {
+				inv.addHost(section, name, vars)
+			}
+		case "vars":
+			vars, err := parseVars([]string{strings.Join(fields, " ")})
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			for k, v := range vars {
+				inv.group(section).vars[k] = v
+			}
+		case "children":
+			g := inv.group(section)
+			g.children = append(g.children, fields[0])
+			inv.group(fields[0])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return inv.hosts()
+}
+
+// splitFields splits an INI line into fields separated by spaces, keeping
+// quoted values together and removing a trailing comment.
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	var quote rune
+	for _, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+				continue
+			}
+			field.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			if field.Len() == 0 {
+				return append(fields, flush(&field)...), nil
+			}
+			field.WriteRune(c)
+		case c == ' ' || c == '\t':
+			fields = append(fields, flush(&field)...)
+		default:
+			field.WriteRune(c)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	return append(fields, flush(&field)...), nil
+}
+
+// flush returns the contents of a field, if any, and resets it.
+func flush(field *strings.Builder) []string {
+	if field.Len() == 0 {
+		return nil
+	}
+	s := field.String()
+	field.Reset()
+	return []string{s}
+}
+
+// parseVars parses key=value fields into a map.
+func parseVars(fields []string) (map[string]string, error) {
+	vars := make(map[string]string, len(fields))
+	for _, field := range fields {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected key=value, got %q", field)
+		}
+		vars[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return vars, nil
+}
+
+// hostRange matches the ranges of an Ansible host pattern, which may contain
+// colons.
+var hostRange = regexp.MustCompile(`\[[^\]]*\]`)
+
+// splitPort splits the port from an Ansible host pattern in the form
+// "host:port" or "[ipv6]:port", setting it as the ansible_port variable
+// unless vars already has one, and returns the host pattern. Patterns
+// without a port, such as a bare IPv6 address, are returned as is.
+func splitPort(pattern string, vars map[string]string) string {
+	host, port, err := net.SplitHostPort(pattern)
+	if _, perr := strconv.Atoi(port); err != nil || perr != nil {
+		// the ranges of a pattern such as "switch[01:20]:2222" are not
+		// IPv6 addresses
+		masked := hostRange.ReplaceAllStringFunc(pattern, func(r string) string {
+			return strings.Repeat("x", len(r))
+		})
+		host, port, err = net.SplitHostPort(masked)
+		if _, perr := strconv.Atoi(port); err != nil || perr != nil {
+			return pattern
+		}
+		host = pattern[:len(host)]
+	}
+	if _, ok := vars["ansible_port"]; !ok {
+		vars["ansible_port"] = port
+	}
+	return host
+}
+
+// expandPattern expands an Ansible host pattern with a numeric or alphabetic
+// range, such as "switch[01:20].example.com" or "db-[a:f]", into host names.
+func expandPattern(pattern string) ([]string, error) {
+	start := strings.Index(pattern, "[")
+	end := strings.Index(pattern, "]")
+	if start < 0 || end < start {
+		return []string{pattern}, nil
+	}
+	bounds := strings.SplitN(pattern[start+1:end], ":", 2)
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid host range %q", pattern)
+	}
+	prefix, suffix := pattern[:start], pattern[end+1:]
+	rest, err := expandPattern(suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	add := func(s string) {
+		for _, r := range rest {
+			names = append(names, prefix+s+r)
+		}
+	}
+	first, err1 := strconv.Atoi(bounds[0])
+	last, err2 := strconv.Atoi(bounds[1])
+	switch {
+	case err1 == nil && err2 == nil && first <= last:
+		format := "%d"
+		if len(bounds[0]) > 1 && bounds[0][0] == '0' {
+			format = fmt.Sprintf("%%0%dd", len(bounds[0]))
+		}
+		for i := first; i <= last; i++ {
+			add(fmt.Sprintf(format, i))
+		}
+	case len(bounds[0]) == 1 && len(bounds[1]) == 1 && bounds[0][0] <= bounds[1][0]:
+		for c := bounds[0][0]; c <= bounds[1][0]; c++ {
+			add(string(c))
+		}
+	default:
+		return nil, fmt.Errorf("invalid host range %q", pattern)
+	}
+	return names, nil
+}
+
+// ansibleYAMLGroup is a group of hosts in an Ansible YAML inventory.
+type ansibleYAMLGroup struct {
+	Hosts    map[string]map[string]interface{} `yaml:"hosts"`
+	Children map[string]*ansibleYAMLGroup      `yaml:"children"`
+	Vars     map[string]interface{}            `yaml:"vars"`
+}
+
+// ParseAnsibleYAML reads an Ansible inventory in YAML format.
+func ParseAnsibleYAML(r io.Reader) ([]Host, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var groups map[string]*ansibleYAMLGroup
+	if err := yaml.Unmarshal(b, &groups); err != nil {
+		return nil, err
+	}
+	inv := newAnsible()
+	for _, name := range sortedKeys(groups) {
+		inv.addYAMLGroup(name, groups[name])
+	}
+	return inv.hosts()
+}
+
+// addYAMLGroup adds a group of an Ansible YAML inventory and its children.
+func (inv *ansible) addYAMLGroup(name string, yg *ansibleYAMLGroup) {
+	g := inv.group(name)
+	if yg == nil {
+		return
+	}
+	for k, v := range yg.Vars {
+		g.vars[k] = fmt.Sprint(v)
+	}
+	hostNames := make([]string, 0, len(yg.Hosts))
+	for host := range yg.Hosts {
+		hostNames = append(hostNames, host)
+	}
+	sort.Strings(hostNames)
+	for _, host := range hostNames {
+		vars := make(map[string]string, len(yg.Hosts[host]))
+		for k, v := range yg.Hosts[host] {
+			vars[k] = fmt.Sprint(v)
+		}
+		inv.addHost(name, splitPort(host, vars), vars)
+	}
+	for _, child := range sortedKeys(yg.Children) {
+		g.children = append(g.children, child)
+		inv.addYAMLGroup(child, yg.Children[child])
+	}
+}
+
+// sortedKeys returns the names of Ansible YAML groups in sorted order.
+func sortedKeys(groups map[string]*ansibleYAMLGroup) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hosts resolves the groups and variables of every host in the inventory.
+func (inv *ansible) hosts() ([]Host, error) {
+	// every group that is not a child of another group is a child of "all"
+	isChild := make(map[string]bool)
+	for _, g := range inv.groups {
+		for _, child := range g.children {
+			isChild[child] = true
+		}
+	}
+	all := inv.group("all")
+	for _, name := range sortedNames(inv.groups) {
+		if name != "all" && !isChild[name] {
+			all.children = append(all.children, name)
+		}
+	}
+
+	// find the depth and parents of each group
+	depth := map[string]int{"all": 0}
+	parents := make(map[string][]string)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		for _, p := range path {
+			if p == name {
+				return fmt.Errorf("group %s is a child of itself", name)
+			}
+		}
+		path = append(path, name)
+		for _, child := range inv.groups[name].children {
+			if d := depth[name] + 1; d > depth[child] {
+				depth[child] = d
+			}
+			parents[child] = appendUnique(parents[child], name)
+			if err := visit(child, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit("all", nil); err != nil {
+		return nil, err
+	}
+	for _, name := range sortedNames(inv.groups) {
+		// a group not reachable from "all" is only a child of its own children
+		if _, ok := depth[name]; !ok {
+			if err := visit(name, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// find the groups each host is a direct member of
+	memberOf := make(map[string][]string)
+	for _, name := range sortedNames(inv.groups) {
+		for _, host := range inv.groups[name].hosts {
+			memberOf[host] = appendUnique(memberOf[host], name)
+		}
+	}
+
+	hosts := make([]Host, 0, len(inv.order))
+	for _, name := range inv.order {
+		groups := memberOf[name]
+		for i := 0; i < len(groups); i++ {
+			for _, p := range parents[groups[i]] {
+				groups = appendUnique(groups, p)
+			}
+		}
+		if len(groups) == 1 && groups[0] == "all" {
+			groups = append(groups, "ungrouped")
+		}
+		sort.SliceStable(groups, func(i, j int) bool {
+			if depth[groups[i]] != depth[groups[j]] {
+				return depth[groups[i]] < depth[groups[j]]
+			}
+			return groups[i] < groups[j]
+		})
+
+		vars := make(map[string]string)
+		for _, g := range groups {
+			for k, v := range inv.groups[g].vars {
+				vars[k] = v
+			}
+		}
+		for k, v := range inv.hostVars[name] {
+			vars[k] = v
+		}
+		h, err := ansibleHost(name, groups, vars)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// ansibleHost creates a host from its Ansible connection variables.
+func ansibleHost(name string, groups []string, vars map[string]string) (Host, error) {
+	h := Host{Name: name, Addr: name, Groups: groups, Vars: vars}
+	for _, key := range []string{"ansible_host", "ansible_ssh_host"} {
+		if v, ok := vars[key]; ok {
+			h.Addr = v
+		}
+	}
+	for _, key := range []string{"ansible_port", "ansible_ssh_port"} {
+		if v, ok := vars[key]; ok {
+			if _, err := strconv.Atoi(v); err != nil {
+				return Host{}, fmt.Errorf("host %s: invalid %s %q", name, key, v)
+			}
+			h.Port = v
+		}
+	}
+	for _, key := range []string{"ansible_user", "ansible_ssh_user"} {
+		if v, ok := vars[key]; ok {
+			h.User = v
+		}
+	}
+	if v, ok := vars["ansible_ssh_private_key_file"]; ok {
+		h.Keys = []string{v}
+	}
+	if v, ok := vars["ansible_ssh_timeout"]; ok {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return Host{}, fmt.Errorf("host %s: invalid ansible_ssh_timeout %q", name, v)
+		}
+		h.Timeout = time.Duration(seconds) * time.Second
+	}
+	if h.Addr == name {
+		h.Name = ""
+	}
+	return h, nil
+}
+
+// sortedNames returns the names of Ansible groups in sorted order.
+func sortedNames(groups map[string]*ansibleGroup) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// appendUnique appends s to a if a does not contain s.
+func appendUnique(a []string, s string) []string {
+	for _, v := range a {
+		if v == s {
+			return a
+		}
+	}
+	return append(a, s)
+}
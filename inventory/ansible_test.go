@@ -0,0 +1,253 @@
+package inventory
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const ansibleINI = `
+# ungrouped hosts
+10.0.0.1
+
+[core]
+core-1 ansible_host=10.1.0.1 ansible_port=2222
+core-2 ansible_host=10.1.0.2 location="row 2" # second core switch
+
+[access]
+access-[01:02].example.com
+
+[access:vars]
+ansible_user = admin
+role=access
+
+[switches:children]
+core
+access
+
+[switches:vars]
+role=switch
+ansible_ssh_private_key_file=~/.ssh/id_rsa
+ansible_ssh_timeout=30
+`
+
+const ansibleYAML = `
+all:
+  hosts:
+    10.0.0.1:
+  vars:
+    role: switch
+  children:
+    core:
+      hosts:
+        core-1:
+          ansible_host: 10.1.0.1
+          ansible_port: 2222
+      vars:
+        role: core
+      children:
+        core-dc1:
+          hosts:
+            core-2:
+              ansible_host: 10.1.0.2
+              ansible_user: admin
+`
+
+func TestParseAnsibleINI(t *testing.T) {
+	got, err := ParseAnsibleINI(strings.NewReader(ansibleINI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	switchVars := map[string]string{
+		"role":                         "switch",
+		"ansible_ssh_private_key_file": "~/.ssh/id_rsa",
+		"ansible_ssh_timeout":          "30",
+	}
+	want := []Host{
+		{Addr: "10.0.0.1", Groups: []string{"all", "ungrouped"}, Vars: map[string]string{}},
+		{
+			Name:    "core-1",
+			Addr:    "10.1.0.1",
+			Port:    "2222",
+			Keys:    []string{"~/.ssh/id_rsa"},
+			Timeout: 30 * time.Second,
+			Groups:  []string{"all", "switches", "core"},
+			Vars:    merge(switchVars, map[string]string{"ansible_host": "10.1.0.1", "ansible_port": "2222"}),
+		},
+		{
+			Name:    "core-2",
+			Addr:    "10.1.0.2",
+			Keys:    []string{"~/.ssh/id_rsa"},
+			Timeout: 30 * time.Second,
+			Groups:  []string{"all", "switches", "core"},
+			Vars:    merge(switchVars, map[string]string{"ansible_host": "10.1.0.2", "location": "row 2"}),
+		},
+		{
+			Addr:    "access-01.example.com",
+			User:    "admin",
+			Keys:    []string{"~/.ssh/id_rsa"},
+			Timeout: 30 * time.Second,
+			Groups:  []string{"all", "switches", "access"},
+			Vars:    merge(switchVars, map[string]string{"ansible_user": "admin", "role": "access"}),
+		},
+		{
+			Addr:    "access-02.example.com",
+			User:    "admin",
+			Keys:    []string{"~/.ssh/id_rsa"},
+			Timeout: 30 * time.Second,
+			Groups:  []string{"all", "switches", "access"},
+			Vars:    merge(switchVars, map[string]string{"ansible_user": "admin", "role": "access"}),
+		},
+	}
+	if !hostsEqual(got, want) {
+		t.Errorf("\nwant: %+v\ngot: %+v", want, got)
+	}
+}
+
+func TestParseAnsibleINI_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"section type", "[core:hostvars]\n"},
+		{"host var", "[core]\ncore-1 ansible_host\n"},
+		{"quote", "[core]\ncore-1 location=\"row 1\n"},
+		{"range", "[core]\ncore-[9:1]\n"},
+		{"port", "[core]\ncore-1 ansible_port=ssh\n"},
+		{"cycle", "[a:children]\nb\n[b:children]\na\n"},
+		{"empty host", "[core]\n\"\"\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseAnsibleINI(strings.NewReader(test.src)); err == nil {
+				t.Error("expected error, got none")
+			} else {
+				t.Logf("got expected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseAnsibleYAML(t *testing.T) {
+	got, err := ParseAnsibleYAML(strings.NewReader(ansibleYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Host{
+		{Addr: "10.0.0.1", Groups: []string{"all", "ungrouped"}, Vars: map[string]string{"role": "switch"}},
+		{
+			Name:   "core-1",
+			Addr:   "10.1.0.1",
+			Port:   "2222",
+			Groups: []string{"all", "core"},
+			Vars:   map[string]string{"role": "core", "ansible_host": "10.1.0.1", "ansible_port": "2222"},
+		},
+		{
+			Name:   "core-2",
+			Addr:   "10.1.0.2",
+			User:   "admin",
+			Groups: []string{"all", "core", "core-dc1"},
+			Vars:   map[string]string{"role": "core", "ansible_host": "10.1.0.2", "ansible_user": "admin"},
+		},
+	}
+	if !hostsEqual(got, want) {
+		t.Errorf("\nwant: %+v\ngot: %+v", want, got)
+	}
+}
+
+func TestParseAnsible_Port(t *testing.T) {
+	tests := []struct {
+		name string
+		ini  string
+		yaml string
+		want []Host
+	}{
+		{
+			name: "host and port",
+			ini:  "[core]\nbadwolf.example.com:5309\n",
+			yaml: "core:\n  hosts:\n    badwolf.example.com:5309:\n",
+			want: []Host{{Addr: "badwolf.example.com", Port: "5309", Groups: []string{"all", "core"}, Vars: map[string]string{"ansible_port": "5309"}}},
+		},
+		{
+			name: "ipv6 and port",
+			ini:  "[core]\n[2001:db8::1]:2222\n",
+			yaml: "core:\n  hosts:\n    '[2001:db8::1]:2222':\n",
+			want: []Host{{Addr: "2001:db8::1", Port: "2222", Groups: []string{"all", "core"}, Vars: map[string]string{"ansible_port": "2222"}}},
+		},
+		{
+			name: "bare ipv6",
+			ini:  "[core]\n2001:db8::1\n",
+			yaml: "core:\n  hosts:\n    '2001:db8::1':\n",
+			want: []Host{{Addr: "2001:db8::1", Groups: []string{"all", "core"}, Vars: map[string]string{}}},
+		},
+		{
+			name: "range and port",
+			ini:  "[core]\nsw[1:2]:2222\n",
+			want: []Host{
+				{Addr: "sw1", Port: "2222", Groups: []string{"all", "core"}, Vars: map[string]string{"ansible_port": "2222"}},
+				{Addr: "sw2", Port: "2222", Groups: []string{"all", "core"}, Vars: map[string]string{"ansible_port": "2222"}},
+			},
+		},
+		{
+			name: "ansible_port",
+			ini:  "[core]\ncore-1:5309 ansible_port=2222\n",
+			yaml: "core:\n  hosts:\n    core-1:5309:\n      ansible_port: 2222\n",
+			want: []Host{{Addr: "core-1", Port: "2222", Groups: []string{"all", "core"}, Vars: map[string]string{"ansible_port": "2222"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseAnsibleINI(strings.NewReader(test.ini))
+			if err != nil {
+				t.Fatalf("ini: unexpected error: %v", err)
+			}
+			if !hostsEqual(got, test.want) {
+				t.Errorf("ini:\nwant: %+v\ngot: %+v", test.want, got)
+			}
+			if test.yaml == "" {
+				// YAML inventories have no host ranges
+				return
+			}
+			got, err = ParseAnsibleYAML(strings.NewReader(test.yaml))
+			if err != nil {
+				t.Fatalf("yaml: unexpected error: %v", err)
+			}
+			if !hostsEqual(got, test.want) {
+				t.Errorf("yaml:\nwant: %+v\ngot: %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestExpandPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"switch", []string{"switch"}},
+		{"switch[1:3]", []string{"switch1", "switch2", "switch3"}},
+		{"sw[08:10].lab", []string{"sw08.lab", "sw09.lab", "sw10.lab"}},
+		{"db-[a:c]", []string{"db-a", "db-b", "db-c"}},
+		{"r[1:2]-[a:b]", []string{"r1-a", "r1-b", "r2-a", "r2-b"}},
+	}
+	for _, test := range tests {
+		got, err := expandPattern(test.pattern)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.pattern, err)
+			continue
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%s: want %v, got %v", test.pattern, test.want, got)
+		}
+	}
+}
+
+func merge(maps ...map[string]string) map[string]string {
+	m := make(map[string]string)
+	for _, vars := range maps {
+		for k, v := range vars {
+			m[k] = v
+		}
+	}
+	return m
+}
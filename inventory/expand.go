@@ -0,0 +1,147 @@
+package inventory
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// MaxExpand is the maximum number of addresses a single CIDR block or IP
+// range may expand to.
+var MaxExpand = 65536
+
+// Expand expands hosts written as CIDR blocks (10.1.20.0/24) or IP ranges
+// (10.1.20.10-10.1.20.50) into one host per address. Hosts prefixed with '!'
+// are exclusions, and remove the matching addresses, CIDR blocks or ranges
+// from the other hosts wherever they appear. Duplicate hosts are removed,
+// keeping the first.
+//
+// The network and broadcast addresses of IPv4 CIDR blocks larger than /31
+// are not included.
+func Expand(hosts []Host) ([]Host, error) {
+	excluded := make(map[string]bool)
+	for _, h := range hosts {
+		if !strings.HasPrefix(h.Addr, "!") {
+			continue
+		}
+		addrs, err := expandAddr(strings.TrimPrefix(h.Addr, "!"))
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			excluded[addr] = true
+		}
+	}
+
+	var expanded []Host
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		if strings.HasPrefix(h.Addr, "!") {
+			continue
+		}
+		addrs, err := expandAddr(h.Addr)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			host := h
+			host.Addr = addr
+			if excluded[addr] || seen[host.String()] {
+				continue
+			}
+			seen[host.String()] = true
+			expanded = append(expanded, host)
+		}
+	}
+	return expanded, nil
+}
+
+// expandAddr expands a CIDR block or IP range into its addresses. Any other
+// address is returned as is, with IP addresses in canonical form.
+func expandAddr(addr string) ([]string, error) {
+	switch {
+	case strings.Contains(addr, "/"):
+		ip, ipNet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, err
+		}
+		first, last := ipNet.IP, lastIP(ipNet)
+		if ip4 := ip.To4(); ip4 != nil {
+			first, last = first.To4(), last.To4()
+			if ones, bits := ipNet.Mask.Size(); bits-ones > 1 {
+				first, last = nextIP(first), prevIP(last)
+			}
+		}
+		return ipRange(addr, first, last)
+	case strings.Contains(addr, "-") && net.ParseIP(strings.SplitN(addr, "-", 2)[0]) != nil:
+		bounds := strings.SplitN(addr, "-", 2)
+		first, last := net.ParseIP(bounds[0]), net.ParseIP(bounds[1])
+		if last == nil {
+			return nil, fmt.Errorf("invalid IP range %s: %q is not an IP address", addr, bounds[1])
+		}
+		if (first.To4() == nil) != (last.To4() == nil) {
+			return nil, fmt.Errorf("invalid IP range %s: mixed IPv4 and IPv6 addresses", addr)
+		}
+		if first.To4() != nil {
+			first, last = first.To4(), last.To4()
+		}
+		if bytes.Compare(first, last) > 0 {
+			return nil, fmt.Errorf("invalid IP range %s: %s is after %s", addr, first, last)
+		}
+		return ipRange(addr, first, last)
+	default:
+		if ip := net.ParseIP(addr); ip != nil {
+			return []string{ip.String()}, nil
+		}
+		return []string{addr}, nil
+	}
+}
+
+// ipRange returns the addresses from first to last inclusive.
+func ipRange(addr string, first, last net.IP) ([]string, error) {
+	var addrs []string
+	for ip := first; bytes.Compare(ip, last) <= 0; ip = nextIP(ip) {
+		if len(addrs) == MaxExpand {
+			return nil, fmt.Errorf("%s expands to more than %d addresses", addr, MaxExpand)
+		}
+		addrs = append(addrs, ip.String())
+		if ip.Equal(last) {
+			break
+		}
+	}
+	return addrs, nil
+}
+
+// lastIP returns the last address of a network.
+func lastIP(ipNet *net.IPNet) net.IP {
+	ip := make(net.IP, len(ipNet.IP))
+	for i := range ip {
+		ip[i] = ipNet.IP[i] | ^ipNet.Mask[i]
+	}
+	return ip
+}
+
+// nextIP returns the address after ip.
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP(nil), ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// prevIP returns the address before ip.
+func prevIP(ip net.IP) net.IP {
+	prev := append(net.IP(nil), ip...)
+	for i := len(prev) - 1; i >= 0; i-- {
+		prev[i]--
+		if prev[i] != 0xff {
+			break
+		}
+	}
+	return prev
+}
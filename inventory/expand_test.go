@@ -0,0 +1,62 @@
+package inventory
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name  string
+		hosts []Host
+		ok    bool
+		want  []string
+	}{
+		{"none", nil, noError, nil},
+		{"hostnames", []Host{{Addr: "switch-1"}, {Addr: "switch-2"}}, noError, []string{"switch-1", "switch-2"}},
+		{"cidr", []Host{{Addr: "10.1.20.0/30"}}, noError, []string{"10.1.20.1", "10.1.20.2"}},
+		{"cidr /31", []Host{{Addr: "10.1.20.0/31"}}, noError, []string{"10.1.20.0", "10.1.20.1"}},
+		{"cidr /32", []Host{{Addr: "10.1.20.7/32"}}, noError, []string{"10.1.20.7"}},
+		{"ipv6 cidr", []Host{{Addr: "fe80::/127"}}, noError, []string{"fe80::", "fe80::1"}},
+		{"range", []Host{{Addr: "10.1.20.254-10.1.21.1"}}, noError, []string{"10.1.20.254", "10.1.20.255", "10.1.21.0", "10.1.21.1"}},
+		{"exclude", []Host{{Addr: "10.1.20.0/29"}, {Addr: "!10.1.20.1"}, {Addr: "!10.1.20.4-10.1.20.5"}}, noError, []string{"10.1.20.2", "10.1.20.3", "10.1.20.6"}},
+		{"exclude hostname", []Host{{Addr: "!switch-2"}, {Addr: "switch-1"}, {Addr: "switch-2"}}, noError, []string{"switch-1"}},
+		{"duplicates", []Host{{Addr: "10.1.20.1"}, {Addr: "10.1.20.0/30"}, {Addr: "10.1.20.2", Port: "2222"}}, noError, []string{"10.1.20.1", "10.1.20.2", "10.1.20.2:2222"}},
+		{"bad cidr", []Host{{Addr: "10.1.20.0/33"}}, hasError, nil},
+		{"bad range", []Host{{Addr: "10.1.20.9-10.1.20.1"}}, hasError, nil},
+		{"mixed range", []Host{{Addr: "10.1.20.1-fe80::1"}}, hasError, nil},
+		{"too large", []Host{{Addr: "10.0.0.0/8"}}, hasError, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Expand(test.hosts)
+			switch {
+			case err != nil && test.ok:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !test.ok:
+				t.Fatal("expected error, got none")
+			case err != nil && !test.ok:
+				t.Logf("got expected error: %v", err)
+			}
+			var addrs []string
+			for _, h := range got {
+				addrs = append(addrs, h.String())
+			}
+			if strings.Join(addrs, ",") != strings.Join(test.want, ",") {
+				t.Errorf("want %v, got %v", test.want, addrs)
+			}
+		})
+	}
+}
+
+func TestExpand_Params(t *testing.T) {
+	got, err := Expand([]Host{{Addr: "10.1.20.0/30", User: "admin", Groups: []string{"access"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range got {
+		if h.User != "admin" || !h.InGroup("access") {
+			t.Errorf("%s: parameters not copied: %+v", h, h)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Host is a host to configure and its connection parameters. Empty fields
+// use the values from the configuration file.
+type Host struct {
+	Name    string            // name of the host in the inventory, if not Addr
+	Addr    string            // hostname or IP address of the host
+	Port    string            // ssh port of the host
+	User    string            // username for host login
+	Pass    string            // password reference for host login
+	Keys    []string          // ssh private keys for authentication
+	Timeout time.Duration     // time to wait to establish an ssh client connection
+	Groups  []string          // groups the host is a member of
+	Vars    map[string]string // variables of the host and its groups
+}
+
+// String returns the address of the host, including the port if it is set.
+func (h Host) String() string {
+	if h.Port == "" {
+		return h.Addr
+	}
+	return net.JoinHostPort(h.Addr, h.Port)
+}
+
+// Load reads the hosts from a hosts file in the given format, either "netcfg"
+// (or "") or "ansible". Files ending in ".yml" or ".yaml" are read as a YAML
+// inventory, and all other files as a plain hosts file, or an INI inventory
+// for the "ansible" format.
+func Load(file, format string) ([]Host, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	yml := filepath.Ext(file) == ".yml" || filepath.Ext(file) == ".yaml"
+	switch format {
+	case "", "netcfg":
+		if yml {
+			return ParseYAML(f)
+		}
+		return Parse(f)
+	case "ansible":
+		if yml {
+			return ParseAnsibleYAML(f)
+		}
+		return ParseAnsibleINI(f)
+	default:
+		return nil, fmt.Errorf("unknown inventory format %q", format)
+	}
+}
+
+// InGroup reports whether the host is a member of the group.
+func (h Host) InGroup(group string) bool {
+	for _, g := range h.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Limit returns the hosts selected by pattern, a comma separated list of
+// group names or glob patterns. A host is selected if any pattern matches its
+// name, its address or the name of one of its groups.
+func Limit(hosts []Host, pattern string) ([]Host, error) {
+	patterns := strings.Split(pattern, ",")
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid limit pattern %q: %v", p, err)
+		}
+	}
+	var limited []Host
+	for _, h := range hosts {
+		if h.matches(patterns) {
+			limited = append(limited, h)
+		}
+	}
+	return limited, nil
+}
+
+// matches reports whether any of the patterns match the host's name or
+// address or the name of one of its groups.
+func (h Host) matches(patterns []string) bool {
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if ok, _ := path.Match(p, h.Addr); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, h.Name); ok && h.Name != "" {
+			return true
+		}
+		for _, g := range h.Groups {
+			if ok, _ := path.Match(p, g); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Parse reads a hosts file with one host per line in the format:
+//
+//	host[:port] [key=value ...]
+//
+// The supported keys are user, pass, keys (separated by commas) and timeout,
+// and keys starting with snmp_, which are kept as variables of the host.
+// Blank lines and lines starting with '#' are ignored.
+func Parse(r io.Reader) ([]Host, error) {
+	var hosts []Host
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		h, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		hosts = append(hosts, h)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// parseLine parses a single host line of a hosts file.
+func parseLine(line string) (Host, error) {
+	fields := strings.Fields(line)
+	h := Host{Addr: fields[0]}
+	if host, port, err := net.SplitHostPort(fields[0]); err == nil {
+		h.Addr, h.Port = host, port
+	}
+	if h.Addr == "" {
+		return Host{}, fmt.Errorf("missing host in %q", fields[0])
+	}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return Host{}, fmt.Errorf("expected key=value, got %q", field)
+		}
+		if err := h.set(kv[0], kv[1]); err != nil {
+			return Host{}, err
+		}
+	}
+	return h, nil
+}
+
+// set sets the host parameter key to value.
+func (h *Host) set(key, value string) error {
+	if strings.HasPrefix(key, "snmp_") {
+		if h.Vars == nil {
+			h.Vars = make(map[string]string)
+		}
+		h.Vars[key] = value
+		return nil
+	}
+	switch key {
+	case "port":
+		h.Port = value
+	case "user":
+		h.User = value
+	case "pass":
+		h.Pass = value
+	case "keys":
+		h.Keys = strings.Split(value, ",")
+	case "timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: %v", value, err)
+		}
+		h.Timeout = timeout
+	default:
+		return fmt.Errorf("unknown host parameter %q", key)
+	}
+	return nil
+}
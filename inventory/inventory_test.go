@@ -0,0 +1,209 @@
+package inventory
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	noError  = true
+	hasError = false
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		ok   bool
+		want []Host
+	}{
+		{"empty", "", noError, nil},
+		{"bare hosts", "10.0.0.1\n\nswitch-1\n", noError, []Host{{Addr: "10.0.0.1"}, {Addr: "switch-1"}}},
+		{"comments", "# core switches\n10.0.0.1\n  # access switches\n", noError, []Host{{Addr: "10.0.0.1"}}},
+		{"port", "10.0.0.1:2222\n[fe80::1]:2222\nfe80::2\n", noError, []Host{
+			{Addr: "10.0.0.1", Port: "2222"},
+			{Addr: "fe80::1", Port: "2222"},
+			{Addr: "fe80::2"},
+		}},
+		{
+			name: "parameters",
+			src:  "10.0.0.1 user=admin pass=env:SWITCH_PASS keys=~/.ssh/id_rsa,~/.ssh/key2 timeout=30s port=2022\n",
+			ok:   noError,
+			want: []Host{{
+				Addr:    "10.0.0.1",
+				Port:    "2022",
+				User:    "admin",
+				Pass:    "env:SWITCH_PASS",
+				Keys:    []string{"~/.ssh/id_rsa", "~/.ssh/key2"},
+				Timeout: 30 * time.Second,
+			}},
+		},
+		{"snmp", "10.0.0.1 snmp_community=env:SNMP_COMMUNITY snmp_port=1161\n", noError, []Host{{
+			Addr: "10.0.0.1",
+			Vars: map[string]string{"snmp_community": "env:SNMP_COMMUNITY", "snmp_port": "1161"},
+		}}},
+		{"unknown parameter", "10.0.0.1 vendor=cisco\n", hasError, nil},
+		{"missing value", "10.0.0.1 user=\n", hasError, nil},
+		{"not key value", "10.0.0.1 admin\n", hasError, nil},
+		{"bad timeout", "10.0.0.1 timeout=10\n", hasError, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(test.src))
+			switch {
+			case err != nil && test.ok:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !test.ok:
+				t.Fatal("expected error, got none")
+			case err != nil && !test.ok:
+				t.Logf("got expected error: %v", err)
+			}
+			if !hostsEqual(got, test.want) {
+				t.Errorf("\nwant: %v\ngot: %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestHost_String(t *testing.T) {
+	tests := []struct {
+		host Host
+		want string
+	}{
+		{Host{Addr: "10.0.0.1"}, "10.0.0.1"},
+		{Host{Addr: "10.0.0.1", Port: "2222"}, "10.0.0.1:2222"},
+		{Host{Addr: "fe80::1", Port: "22"}, "[fe80::1]:22"},
+	}
+	for _, test := range tests {
+		if got := test.host.String(); got != test.want {
+			t.Errorf("want %s, got %s", test.want, got)
+		}
+	}
+}
+
+func hostsEqual(x, y []Host) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i].Name != y[i].Name ||
+			x[i].Addr != y[i].Addr ||
+			x[i].Port != y[i].Port ||
+			x[i].User != y[i].User ||
+			x[i].Pass != y[i].Pass ||
+			strings.Join(x[i].Keys, ",") != strings.Join(y[i].Keys, ",") ||
+			x[i].Timeout != y[i].Timeout ||
+			strings.Join(x[i].Groups, ",") != strings.Join(y[i].Groups, ",") ||
+			len(x[i].Vars) != len(y[i].Vars) {
+			return false
+		}
+		for k, v := range x[i].Vars {
+			if y[i].Vars[k] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+const inventoryYAML = `
+---
+core:
+  vars:
+    role: core
+    location: row-1
+  hosts:
+    10.1.0.1:
+    10.1.0.2:
+      port: 2222
+      user: admin
+      timeout: 30s
+      vars:
+        location: row-2
+  children:
+    core-dc1:
+      vars:
+        site: dc1
+      hosts:
+        10.1.1.1:
+          keys:
+            - ~/.ssh/id_rsa
+access:
+  vars:
+    role: access
+  hosts:
+    10.2.0.1:
+      pass: env:ACCESS_PASS
+`
+
+func TestParseYAML(t *testing.T) {
+	got, err := ParseYAML(strings.NewReader(inventoryYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Host{
+		{Addr: "10.2.0.1", Pass: "env:ACCESS_PASS", Groups: []string{"access"}, Vars: map[string]string{"role": "access"}},
+		{Addr: "10.1.0.1", Groups: []string{"core"}, Vars: map[string]string{"role": "core", "location": "row-1"}},
+		{
+			Addr:    "10.1.0.2",
+			Port:    "2222",
+			User:    "admin",
+			Timeout: 30 * time.Second,
+			Groups:  []string{"core"},
+			Vars:    map[string]string{"role": "core", "location": "row-2"},
+		},
+		{
+			Addr:   "10.1.1.1",
+			Keys:   []string{"~/.ssh/id_rsa"},
+			Groups: []string{"core", "core-dc1"},
+			Vars:   map[string]string{"role": "core", "location": "row-1", "site": "dc1"},
+		},
+	}
+	if !hostsEqual(got, want) {
+		t.Errorf("\nwant: %v\ngot: %v", want, got)
+	}
+
+	if _, err := ParseYAML(strings.NewReader("core: [10.0.0.1]")); err == nil {
+		t.Error("expected error, got none")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	hosts := []Host{
+		{Addr: "10.1.0.1", Groups: []string{"core"}},
+		{Addr: "10.1.1.1", Groups: []string{"core", "core-dc1"}},
+		{Addr: "10.2.0.1", Groups: []string{"access"}},
+		{Addr: "switch-1"},
+	}
+	tests := []struct {
+		pattern string
+		ok      bool
+		want    []string
+	}{
+		{"core", noError, []string{"10.1.0.1", "10.1.1.1"}},
+		{"core-*", noError, []string{"10.1.1.1"}},
+		{"access,switch-*", noError, []string{"10.2.0.1", "switch-1"}},
+		{"10.1.*", noError, []string{"10.1.0.1", "10.1.1.1"}},
+		{"dist", noError, nil},
+		{"[", hasError, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			got, err := Limit(hosts, test.pattern)
+			switch {
+			case err != nil && test.ok:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !test.ok:
+				t.Fatal("expected error, got none")
+			}
+			var addrs []string
+			for _, h := range got {
+				addrs = append(addrs, h.Addr)
+			}
+			if strings.Join(addrs, ",") != strings.Join(test.want, ",") {
+				t.Errorf("want %v, got %v", test.want, addrs)
+			}
+		})
+	}
+}
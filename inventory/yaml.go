@@ -0,0 +1,184 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// group is a named group of hosts in a YAML inventory.
+type group struct {
+	Hosts    map[string]*params     `yaml:"hosts"`    // hosts in the group
+	Children map[string]*group      `yaml:"children"` // child groups of the group
+	Vars     map[string]interface{} `yaml:"vars"`     // variables for every host in the group
+}
+
+// params are the connection parameters and variables of a host in a YAML inventory.
+type params struct {
+	Port    int                    `yaml:"port"`    // ssh port of the host
+	User    string                 `yaml:"user"`    // username for host login
+	Pass    string                 `yaml:"pass"`    // password reference for host login
+	Keys    []string               `yaml:"keys"`    // ssh private keys for authentication
+	Timeout time.Duration          `yaml:"timeout"` // time to wait to establish an ssh client connection
+	Vars    map[string]interface{} `yaml:"vars"`    // variables of the host
+}
+
+// ParseYAML reads a YAML inventory of named groups of hosts. Each group may
+// list its hosts with their connection parameters and variables, its child
+// groups, and variables shared by every host in the group:
+//
+//	core:
+//	  hosts:
+//	    10.1.0.1:
+//	    10.1.0.2:
+//	      port: 2222
+//	      user: admin
+//	      vars:
+//	        location: row-2
+//	  vars:
+//	    location: row-1
+//	  children:
+//	    core-dc1:
+//	      hosts:
+//	        10.1.1.1:
+//
+// A host in a child group is also a member of every parent group. Host
+// variables take precedence over group variables, and the variables of a
+// child group take precedence over those of its parents.
+func ParseYAML(r io.Reader) ([]Host, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var groups map[string]*group
+	if err := yaml.Unmarshal(b, &groups); err != nil {
+		return nil, err
+	}
+
+	inv := &yamlInventory{hosts: make(map[string]*yamlHost)}
+	for _, name := range sortedGroups(groups) {
+		if err := inv.walk(name, groups[name], nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	hosts := make([]Host, 0, len(inv.order))
+	for _, addr := range inv.order {
+		h := inv.hosts[addr]
+		for k, v := range h.hostVars {
+			h.Vars[k] = v
+		}
+		hosts = append(hosts, h.Host)
+	}
+	return hosts, nil
+}
+
+// yamlInventory collects the hosts of a YAML inventory as its groups are walked.
+type yamlInventory struct {
+	hosts map[string]*yamlHost // hosts by address
+	order []string             // addresses of the hosts in the order first seen
+}
+
+// yamlHost is a host and the variables set on the host itself.
+type yamlHost struct {
+	Host
+	hostVars map[string]string // variables set on the host
+}
+
+// walk adds the hosts of a group and its child groups to the inventory.
+// parents are the names of the parent groups and vars the merged variables
+// of the parent groups.
+func (inv *yamlInventory) walk(name string, g *group, parents []string, vars map[string]string) error {
+	groups := append(append([]string(nil), parents...), name)
+	if g == nil {
+		return nil
+	}
+
+	groupVars := make(map[string]string, len(vars)+len(g.Vars))
+	for k, v := range vars {
+		groupVars[k] = v
+	}
+	for k, v := range g.Vars {
+		groupVars[k] = fmt.Sprint(v)
+	}
+
+	addrs := make([]string, 0, len(g.Hosts))
+	for addr := range g.Hosts {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		if err := inv.add(addr, g.Hosts[addr], groups, groupVars); err != nil {
+			return fmt.Errorf("group %s: %v", name, err)
+		}
+	}
+
+	for _, child := range sortedGroups(g.Children) {
+		if err := inv.walk(child, g.Children[child], groups, groupVars); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds a host of a group to the inventory, merging it with any previous
+// entry for the same host.
+func (inv *yamlInventory) add(addr string, p *params, groups []string, vars map[string]string) error {
+	h, ok := inv.hosts[addr]
+	if !ok {
+		h = &yamlHost{
+			Host:     Host{Addr: addr, Vars: make(map[string]string)},
+			hostVars: make(map[string]string),
+		}
+		inv.hosts[addr] = h
+		inv.order = append(inv.order, addr)
+	}
+	for _, g := range groups {
+		if !h.InGroup(g) {
+			h.Groups = append(h.Groups, g)
+		}
+	}
+	for k, v := range vars {
+		h.Vars[k] = v
+	}
+	if p == nil {
+		return nil
+	}
+	if p.Port < 0 || p.Port > 65535 {
+		return fmt.Errorf("host %s: invalid port %d", addr, p.Port)
+	}
+	if p.Port != 0 {
+		h.Port = strconv.Itoa(p.Port)
+	}
+	if p.User != "" {
+		h.User = p.User
+	}
+	if p.Pass != "" {
+		h.Pass = p.Pass
+	}
+	if len(p.Keys) > 0 {
+		h.Keys = p.Keys
+	}
+	if p.Timeout != 0 {
+		h.Timeout = p.Timeout
+	}
+	for k, v := range p.Vars {
+		h.hostVars[k] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// sortedGroups returns the names of groups in sorted order.
+func sortedGroups(groups map[string]*group) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}